@@ -0,0 +1,336 @@
+package hfw
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	logger "github.com/hsyan2008/go-logger"
+	"github.com/hsyan2008/hfw/common"
+	"github.com/hsyan2008/hfw/configs"
+	"github.com/hsyan2008/hfw/encoding"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	accessLogJSON     = "json"
+	accessLogCombined = "combined"
+	//combined后面追加trace_id和耗时(毫秒)
+	accessLogCombinedTrace = "combined+trace"
+
+	accessLogDateFormat = "2006-01-02"
+)
+
+//没有配置AccessLogFile的时候是nil
+var accessLogger *accessLogWriter
+
+//accessLogEntry 访问日志的字段，耗时的单位是毫秒，TTFB是首字节的时间
+//grpc的Method是GRPC或者Stream，Status是grpc的code
+type accessLogEntry struct {
+	Time       time.Time `json:"time"`
+	TraceID    string    `json:"trace_id"`
+	ClientIP   string    `json:"client_ip"`
+	Method     string    `json:"method"`
+	Path       string    `json:"path"`
+	Proto      string    `json:"proto"`
+	Status     int       `json:"status"`
+	Bytes      int64     `json:"bytes"`
+	Latency    float64   `json:"latency_ms"`
+	TTFB       float64   `json:"ttfb_ms,omitempty"`
+	UserAgent  string    `json:"user_agent"`
+	Referer    string    `json:"referer,omitempty"`
+	Controller string    `json:"controller,omitempty"`
+	Action     string    `json:"action,omitempty"`
+	Route      string    `json:"route,omitempty"`
+	ErrNo      int64     `json:"err_no,omitempty"`
+}
+
+//initAccessLog 按Logger.AccessLogFile初始化访问日志
+func initAccessLog(lc configs.LoggerConfig) (err error) {
+	if lc.AccessLogFile == "" {
+		return
+	}
+	w, err := newAccessLogWriter(lc)
+	if err != nil {
+		return
+	}
+	err = w.open()
+	if err != nil {
+		return
+	}
+	if accessLogger != nil {
+		accessLogger.close()
+	}
+	accessLogger = w
+
+	return
+}
+
+func newAccessLogWriter(lc configs.LoggerConfig) (w *accessLogWriter, err error) {
+	format := strings.ToLower(lc.AccessLogFormat)
+	if format == "" {
+		format = accessLogJSON
+	} else if format != accessLogJSON && format != accessLogCombined && format != accessLogCombinedTrace {
+		return nil, errors.New("undefined access log format: " + lc.AccessLogFormat)
+	}
+
+	//相对路径相对于程序所在目录，和工作目录无关
+	path := lc.AccessLogFile
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(common.GetAppPath(), path)
+	}
+
+	w = &accessLogWriter{
+		path:   path,
+		format: format,
+	}
+	switch strings.ToLower(lc.AccessLogType) {
+	case "", "daily":
+		w.isDaily = true
+	case "roll":
+		w.maxNum = int(lc.LogMaxNum)
+		w.maxSize = lc.LogSize * logUnit(lc.LogUnit)
+	default:
+		return nil, errors.New("undefined access log type: " + lc.AccessLogType)
+	}
+
+	return
+}
+
+//reloadAccessLog 配置修改后在原来的writer上重新打开文件，开启或者关闭访问日志需要重启
+func reloadAccessLog(lc configs.LoggerConfig) (err error) {
+	if (lc.AccessLogFile == "") != (accessLogger == nil) {
+		return errors.New("enable or disable access log need restart")
+	}
+	if accessLogger == nil {
+		return
+	}
+	nw, err := newAccessLogWriter(lc)
+	if err != nil {
+		return
+	}
+
+	w := accessLogger
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.file != nil {
+		_ = w.file.Close()
+		w.file = nil
+	}
+	w.path, w.format = nw.path, nw.format
+	w.isDaily, w.maxNum, w.maxSize = nw.isDaily, nw.maxNum, nw.maxSize
+
+	return w.open()
+}
+
+//writeAccessLog http请求结束的时候记录，包括controller和HandlerFunc
+func (httpCtx *HTTPContext) writeAccessLog(startTime time.Time) {
+	if accessLogger == nil {
+		return
+	}
+	r := httpCtx.Request
+	entry := &accessLogEntry{
+		Time:       startTime,
+		TraceID:    httpCtx.GetTraceID(),
+		ClientIP:   clientIP(httpCtx),
+		Method:     r.Method,
+		Path:       r.URL.RequestURI(),
+		Proto:      r.Proto,
+		Status:     httpCtx.ResponseStatus(),
+		Bytes:      httpCtx.ResponseSize(),
+		Latency:    latencyMS(startTime),
+		UserAgent:  r.UserAgent(),
+		Referer:    r.Referer(),
+		Controller: httpCtx.Controller,
+		Action:     httpCtx.Action,
+		Route:      httpCtx.Route,
+		ErrNo:      httpCtx.ErrNo,
+	}
+	if w, ok := httpCtx.ResponseWriter.(*responseWriter); ok && !w.firstByte.IsZero() {
+		entry.TTFB = float64(w.firstByte.Sub(startTime).Microseconds()) / 1000
+	}
+
+	accessLogger.write(entry)
+}
+
+//writeGrpcAccessLog grpc请求结束的时候记录，size是响应消息的大小，stream是0
+func (httpCtx *HTTPContext) writeGrpcAccessLog(startTime time.Time, err error, size int) {
+	if accessLogger == nil {
+		return
+	}
+	entry := &accessLogEntry{
+		Time:     startTime,
+		TraceID:  httpCtx.GetTraceID(),
+		ClientIP: clientIP(httpCtx),
+		Method:   httpCtx.requestMethod,
+		Path:     httpCtx.requestPath,
+		Proto:    "HTTP/2.0",
+		Status:   int(status.Code(err)),
+		Bytes:    int64(size),
+		Latency:  latencyMS(startTime),
+		ErrNo:    httpCtx.ErrNo,
+	}
+	if entry.Status != int(codes.OK) && entry.ErrNo == 0 {
+		entry.ErrNo = int64(entry.Status)
+	}
+	if md, ok := metadata.FromIncomingContext(httpCtx); ok {
+		if v := md.Get("user-agent"); len(v) > 0 {
+			entry.UserAgent = v[0]
+		}
+	}
+
+	accessLogger.write(entry)
+}
+
+func latencyMS(startTime time.Time) float64 {
+	return float64(time.Since(startTime).Microseconds()) / 1000
+}
+
+//format 一行日志，不包含换行
+func (entry *accessLogEntry) format(format string) ([]byte, error) {
+	if format == accessLogJSON {
+		return encoding.JSON.Marshal(entry)
+	}
+
+	//Apache combined
+	bytes := "-"
+	if entry.Bytes > 0 {
+		bytes = strconv.FormatInt(entry.Bytes, 10)
+	}
+	line := fmt.Sprintf(`%s - - [%s] "%s %s %s" %d %s "%s" "%s"`,
+		orDash(entry.ClientIP), entry.Time.Format("02/Jan/2006:15:04:05 -0700"),
+		entry.Method, entry.Path, entry.Proto, entry.Status, bytes,
+		orDash(entry.Referer), orDash(entry.UserAgent))
+	if format == accessLogCombinedTrace {
+		line += fmt.Sprintf(" %s %.3f", orDash(entry.TraceID), entry.Latency)
+	}
+
+	return []byte(line), nil
+}
+
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+
+	return s
+}
+
+func logUnit(unit string) int64 {
+	switch strings.ToUpper(unit) {
+	case "M", "MB":
+		return 1 << 20
+	case "G", "GB":
+		return 1 << 30
+	case "T", "TB":
+		return 1 << 40
+	}
+
+	return 1 << 10
+}
+
+//accessLogWriter 单独的访问日志文件，按天或者按大小切割，和Logger.LogType的规则一致
+type accessLogWriter struct {
+	path   string
+	format string
+
+	isDaily bool
+	maxNum  int
+	maxSize int64
+
+	mu   sync.Mutex
+	file *os.File
+	date string
+	size int64
+}
+
+func (w *accessLogWriter) open() (err error) {
+	err = os.MkdirAll(filepath.Dir(w.path), 0755)
+	if err != nil {
+		return
+	}
+	f, err := os.OpenFile(w.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return
+	}
+	fi, err := f.Stat()
+	if err != nil {
+		_ = f.Close()
+		return
+	}
+	w.file = f
+	w.size = fi.Size()
+	w.date = fi.ModTime().Format(accessLogDateFormat)
+
+	return
+}
+
+func (w *accessLogWriter) write(entry *accessLogEntry) {
+	//reload的时候会修改format
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	line, err := entry.format(w.format)
+	if err != nil {
+		return
+	}
+	line = append(line, '\n')
+
+	w.rotate(entry.Time)
+	if w.file == nil {
+		return
+	}
+	n, _ := w.file.Write(line)
+	w.size += int64(n)
+}
+
+//rotate daily的时候改名为path.2006-01-02，roll的时候依次改名为path.1到path.maxNum
+func (w *accessLogWriter) rotate(now time.Time) {
+	var err error
+	if w.isDaily {
+		today := now.Format(accessLogDateFormat)
+		if w.file != nil && today == w.date {
+			return
+		}
+		if w.file != nil {
+			_ = w.file.Close()
+			//重启后可能已经切割过
+			if target := w.path + "." + w.date; !common.IsExist(target) {
+				err = os.Rename(w.path, target)
+			}
+		}
+	} else {
+		if w.file != nil && (w.maxNum <= 1 || w.maxSize <= 0 || w.size < w.maxSize) {
+			return
+		}
+		if w.file != nil {
+			_ = w.file.Close()
+			for i := w.maxNum - 1; i > 0; i-- {
+				_ = os.Rename(w.path+"."+strconv.Itoa(i), w.path+"."+strconv.Itoa(i+1))
+			}
+			err = os.Rename(w.path, w.path+".1")
+		}
+	}
+	if err != nil {
+		logger.Warn("rotate access log:", err)
+	}
+	w.file = nil
+	if err = w.open(); err != nil {
+		logger.Warn("open access log:", err)
+	}
+}
+
+func (w *accessLogWriter) close() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.file != nil {
+		_ = w.file.Close()
+		w.file = nil
+	}
+}
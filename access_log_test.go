@@ -0,0 +1,97 @@
+package hfw
+
+import (
+	"bufio"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hsyan2008/hfw/common"
+	"github.com/hsyan2008/hfw/configs"
+	"github.com/hsyan2008/hfw/encoding"
+)
+
+func TestAccessLog(t *testing.T) {
+	defer func() {
+		accessLogger.close()
+		accessLogger = nil
+	}()
+	path := filepath.Join(t.TempDir(), "access.log")
+	err := initAccessLog(configs.LoggerConfig{AccessLogFile: path})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	HandlerFunc("/test/access_log", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusCreated)
+		_, _ = w.Write([]byte("hello"))
+	})
+	r := httptest.NewRequest("GET", "/test/access_log?a=1", nil)
+	r.Header.Set("User-Agent", "hfw-test")
+	http.DefaultServeMux.ServeHTTP(httptest.NewRecorder(), r)
+
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	s := bufio.NewScanner(f)
+	if !s.Scan() {
+		t.Fatal("empty access log")
+	}
+	var entry accessLogEntry
+	if err = encoding.JSON.Unmarshal(s.Bytes(), &entry); err != nil {
+		t.Fatal(err)
+	}
+	if entry.Status != http.StatusCreated || entry.Bytes != 5 || entry.Path != "/test/access_log?a=1" ||
+		entry.UserAgent != "hfw-test" || entry.TraceID == "" {
+		t.Errorf("entry: %+v", entry)
+	}
+
+	entry.Time = time.Date(2023, 5, 1, 8, 0, 0, 0, time.UTC)
+	entry.Latency = 1.5
+	line, _ := entry.format(accessLogCombined)
+	expect := `- - [01/May/2023:08:00:00 +0000] "GET /test/access_log?a=1 HTTP/1.1" 201 5 "-" "hfw-test"`
+	if !strings.HasSuffix(string(line), expect) {
+		t.Errorf("combined: %s", line)
+	}
+	line, _ = entry.format(accessLogCombinedTrace)
+	if !strings.HasSuffix(string(line), expect+" "+entry.TraceID+" 1.500") {
+		t.Errorf("combined+trace: %s", line)
+	}
+}
+
+func TestAccessLogPath(t *testing.T) {
+	w, err := newAccessLogWriter(configs.LoggerConfig{AccessLogFile: "logs/access.log"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if w.path != filepath.Join(common.GetAppPath(), "logs/access.log") {
+		t.Errorf("path: %s", w.path)
+	}
+}
+
+func TestAccessLogRoll(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "access.log")
+	w := &accessLogWriter{path: path, format: accessLogCombined, maxNum: 2, maxSize: 10}
+	if err := w.open(); err != nil {
+		t.Fatal(err)
+	}
+	defer w.close()
+
+	for i := 0; i < 3; i++ {
+		w.write(&accessLogEntry{Time: time.Now(), Method: "GET", Path: "/"})
+	}
+	for _, v := range []string{path, path + ".1", path + ".2"} {
+		if _, err := os.Stat(v); err != nil {
+			t.Error(err)
+		}
+	}
+	if _, err := os.Stat(path + ".3"); err == nil {
+		t.Error("expect at most 2 backups")
+	}
+}
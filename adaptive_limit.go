@@ -0,0 +1,207 @@
+package hfw
+
+import (
+	"math"
+	"net/http"
+	"runtime"
+	"sync"
+	"time"
+
+	"github.com/hsyan2008/hfw/configs"
+	"github.com/hsyan2008/hfw/prometheus"
+	"github.com/hsyan2008/hfw/signal"
+)
+
+const (
+	//短期和长期延迟的EWMA系数
+	shortRTTAlpha = 0.2
+	longRTTAlpha  = 2.0 / 601
+	//limit每次调整的平滑系数
+	limitSmoothing = 0.2
+	cpuInterval    = 250 * time.Millisecond
+	cpuAlpha       = 0.5
+)
+
+var (
+	adaptive   *adaptiveLimiter
+	adaptiveMu = new(sync.RWMutex)
+
+	cpuUsage     float64
+	cpuMu        = new(sync.RWMutex)
+	cpuStartOnce = new(sync.Once)
+)
+
+//SetAdaptiveLimit 设置自适应限流，Init的时候使用Limit.Adaptive
+func SetAdaptiveLimit(conf configs.AdaptiveLimitConfig) {
+	var l *adaptiveLimiter
+	if conf.IsEnable {
+		l = newAdaptiveLimiter(conf)
+		if conf.CPUThreshold > 0 {
+			if _, ok := processCPUTime(); ok {
+				cpuStartOnce.Do(func() {
+					go sampleCPU()
+				})
+			}
+		}
+	}
+
+	adaptiveMu.Lock()
+	defer adaptiveMu.Unlock()
+	adaptive = l
+}
+
+//AdaptiveLimitMiddleware 根据延迟和cpu自动调整允许的并发，超过的返回503
+//grpc的Stream是长连接，不参与
+func AdaptiveLimitMiddleware(next ContextHandler) ContextHandler {
+	return func(httpCtx *HTTPContext) {
+		adaptiveMu.RLock()
+		l := adaptive
+		adaptiveMu.RUnlock()
+		if l == nil || httpCtx.requestMethod == "Stream" {
+			next(httpCtx)
+			return
+		}
+
+		if reason := l.acquire(); reason != "" {
+			httpCtx.Warnf("adaptive limit: reject by %s, limit:%.1f", reason, l.getLimit())
+			prometheus.LimitRejected(httpCtx.requestPath, httpCtx.requestMethod, "adaptive", reason)
+			httpCtx.HTTPStatus = http.StatusServiceUnavailable
+			httpCtx.ErrNo = http.StatusServiceUnavailable
+			httpCtx.ErrMsg = "server overloaded"
+			return
+		}
+		defer func(startTime time.Time) {
+			l.release(time.Since(startTime))
+		}(time.Now())
+
+		next(httpCtx)
+	}
+}
+
+//adaptiveLimiter 参考Netflix concurrency-limits的gradient2
+//短期延迟接近长期延迟的时候，limit按sqrt(limit)增长，短期延迟变高的时候按比例减少
+type adaptiveLimiter struct {
+	conf configs.AdaptiveLimitConfig
+
+	mu       sync.Mutex
+	limit    float64
+	inflight int
+	//纳秒
+	shortRTT float64
+	longRTT  float64
+}
+
+func newAdaptiveLimiter(conf configs.AdaptiveLimitConfig) *adaptiveLimiter {
+	if conf.MinLimit <= 0 {
+		conf.MinLimit = 1
+	}
+	if conf.MaxLimit <= 0 {
+		conf.MaxLimit = 1000
+	}
+	if conf.InitLimit <= 0 {
+		conf.InitLimit = 20
+	}
+	if conf.Tolerance < 1 {
+		conf.Tolerance = 1.5
+	}
+	l := &adaptiveLimiter{conf: conf}
+	l.limit = l.clamp(float64(conf.InitLimit))
+
+	return l
+}
+
+func (l *adaptiveLimiter) getLimit() float64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.limit
+}
+
+//acquire 返回不为空表示拒绝，latency或cpu
+func (l *adaptiveLimiter) acquire() string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if float64(l.inflight) >= l.limit {
+		return "latency"
+	}
+	//至少放行一个请求，用于更新延迟
+	if l.conf.CPUThreshold > 0 && l.inflight > 0 && getCPUUsage() > l.conf.CPUThreshold {
+		return "cpu"
+	}
+	l.inflight++
+	prometheus.LimitInflight("adaptive", 1)
+
+	return ""
+}
+
+func (l *adaptiveLimiter) release(rtt time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	inflight := l.inflight
+	l.inflight--
+	prometheus.LimitInflight("adaptive", -1)
+	l.update(float64(rtt), inflight)
+}
+
+func (l *adaptiveLimiter) update(rtt float64, inflight int) {
+	if rtt <= 0 {
+		rtt = 1
+	}
+	if l.longRTT == 0 {
+		l.shortRTT, l.longRTT = rtt, rtt
+	}
+	l.shortRTT = l.shortRTT*(1-shortRTTAlpha) + rtt*shortRTTAlpha
+	l.longRTT = l.longRTT*(1-longRTTAlpha) + rtt*longRTTAlpha
+	//长期延迟明显高于短期延迟，说明负载已经下降，加快长期延迟的恢复
+	if l.longRTT/l.shortRTT > 2 {
+		l.longRTT *= 0.95
+	}
+
+	//请求没有用到一半的limit，不需要调整，避免limit一直增长
+	if float64(inflight)*2 < l.limit {
+		return
+	}
+
+	gradient := math.Max(0.5, math.Min(1, l.conf.Tolerance*l.longRTT/l.shortRTT))
+	newLimit := l.limit*gradient + math.Sqrt(l.limit)
+	l.limit = l.clamp(l.limit*(1-limitSmoothing) + newLimit*limitSmoothing)
+
+	prometheus.LimitAdaptive("limit", l.limit)
+	prometheus.LimitAdaptive("rtt_short", l.shortRTT/float64(time.Millisecond))
+	prometheus.LimitAdaptive("rtt_long", l.longRTT/float64(time.Millisecond))
+}
+
+func (l *adaptiveLimiter) clamp(limit float64) float64 {
+	return math.Max(float64(l.conf.MinLimit), math.Min(float64(l.conf.MaxLimit), limit))
+}
+
+func getCPUUsage() float64 {
+	cpuMu.RLock()
+	defer cpuMu.RUnlock()
+	return cpuUsage
+}
+
+//sampleCPU 定时计算进程的cpu使用率，按机器的cpu核数换算成0-100
+func sampleCPU() {
+	ticker := time.NewTicker(cpuInterval)
+	defer ticker.Stop()
+	lastCPU, _ := processCPUTime()
+	lastTime := time.Now()
+	for {
+		select {
+		case <-signal.GetSignalContext().Ctx.Done():
+			return
+		case now := <-ticker.C:
+			cpu, _ := processCPUTime()
+			usage := float64(cpu-lastCPU) / float64(now.Sub(lastTime)) / float64(runtime.NumCPU()) * 100
+			lastCPU, lastTime = cpu, now
+
+			cpuMu.Lock()
+			cpuUsage = cpuUsage*(1-cpuAlpha) + usage*cpuAlpha
+			usage = cpuUsage
+			cpuMu.Unlock()
+			prometheus.LimitAdaptive("cpu", usage)
+		}
+	}
+}
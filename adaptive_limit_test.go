@@ -0,0 +1,42 @@
+package hfw
+
+import (
+	"testing"
+	"time"
+
+	"github.com/hsyan2008/hfw/configs"
+)
+
+func TestAdaptiveLimiter(t *testing.T) {
+	l := newAdaptiveLimiter(configs.AdaptiveLimitConfig{IsEnable: true, InitLimit: 10, MaxLimit: 100})
+
+	//延迟稳定，并发较高的时候limit增长
+	for i := 0; i < 50; i++ {
+		l.update(float64(10*time.Millisecond), int(l.limit))
+	}
+	grown := l.limit
+	if grown <= 10 {
+		t.Fatalf("expect limit grow, got %.1f", grown)
+	}
+
+	//延迟变高，limit减少
+	for i := 0; i < 20; i++ {
+		l.update(float64(100*time.Millisecond), int(l.limit))
+	}
+	if l.limit >= grown {
+		t.Errorf("expect limit shrink, got %.1f >= %.1f", l.limit, grown)
+	}
+
+	//达到limit后拒绝
+	l = newAdaptiveLimiter(configs.AdaptiveLimitConfig{IsEnable: true, InitLimit: 2})
+	if l.acquire() != "" || l.acquire() != "" {
+		t.Fatal("expect pass")
+	}
+	if reason := l.acquire(); reason != "latency" {
+		t.Errorf("expect latency, got %q", reason)
+	}
+	l.release(time.Millisecond)
+	if reason := l.acquire(); reason != "" {
+		t.Errorf("expect pass after release, got %q", reason)
+	}
+}
@@ -17,6 +17,8 @@ import (
 	"github.com/hsyan2008/hfw/curl"
 	"github.com/hsyan2008/hfw/encoding"
 	"github.com/hsyan2008/hfw/service/discovery"
+	"github.com/hsyan2008/hfw/tracing"
+	"go.opentelemetry.io/otel/trace"
 )
 
 //内部第三方接口返回
@@ -57,7 +59,7 @@ func RequestUnmarshal(httpCtx *hfw.HTTPContext, params interface{}) (err error)
 //用于调用内部的其他标准http服务
 //标准的http服务是指response里包含err_no、err_msg和results
 func StdCallByConsul(httpCtx *hfw.HTTPContext, serviceName, uri string, p interface{}, results interface{}, opts ...CallOption) (err error) {
-	resolverAddresses := configs.Config.Server.ResolverAddresses
+	resolverAddresses := configs.Get().Server.ResolverAddresses
 	if len(resolverAddresses) == 0 {
 		return errors.New("nil resolverAddresses")
 	}
@@ -96,6 +98,10 @@ func Call(httpCtxIn *hfw.HTTPContext, header map[string]string, addressParams in
 	httpCtx := hfw.NewHTTPContextWithCtx(httpCtxIn)
 	defer httpCtx.Cancel()
 
+	var span trace.Span
+	httpCtx.Ctx, span = tracing.Start(httpCtx.Ctx, "api.Call "+uri, trace.SpanKindInternal)
+	defer func() { tracing.End(span, err) }()
+
 	var (
 		cr        *discovery.ConsulResolver
 		addresses []string
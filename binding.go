@@ -0,0 +1,314 @@
+package hfw
+
+import (
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/hsyan2008/hfw/common"
+	"github.com/hsyan2008/hfw/encoding"
+	"github.com/hsyan2008/hfw/validator"
+)
+
+//multipart表单在内存里的最大值，超过的部分写临时文件
+var MaxMultipartMemory int64 = 32 << 20
+
+var (
+	fileHeaderType      = reflect.TypeOf((*multipart.FileHeader)(nil))
+	fileHeaderSliceType = reflect.TypeOf([]*multipart.FileHeader(nil))
+	timeType            = reflect.TypeOf(time.Time{})
+)
+
+//Bind 解析请求数据到v并校验，失败的时候ThrowCheck(400)，validate标签有错误的时候ThrowCheck(500)
+//校验失败时，Results里是每个字段的错误信息
+func (httpCtx *HTTPContext) Bind(v interface{}) {
+	err := httpCtx.ShouldBind(v)
+	if err == nil {
+		return
+	}
+	//标签写错了是服务端的问题
+	var tagErr *validator.TagError
+	if errors.As(err, &tagErr) {
+		httpCtx.HTTPStatus = http.StatusInternalServerError
+		httpCtx.ThrowCheck(500, err)
+	}
+	var errs validator.Errors
+	if errors.As(err, &errs) {
+		httpCtx.Results = errs.Map()
+	}
+	httpCtx.ThrowCheck(400, common.NewRespErr(400, err))
+}
+
+//ShouldBind 解析请求数据到v并校验，v必须是struct指针
+//依次从query、form(含multipart)、json/xml body、路由参数里取值，后面的覆盖前面的
+//query取query标签，没有则依次取form、json标签和字段名
+//form取form标签，没有则依次取json标签和字段名
+//路由参数只取param标签
+//multipart的文件，字段类型是*multipart.FileHeader或[]*multipart.FileHeader
+func (httpCtx *HTTPContext) ShouldBind(v interface{}) (err error) {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() || rv.Elem().Kind() != reflect.Struct {
+		return errors.New("bind: v must be a non-nil struct pointer")
+	}
+	rv = rv.Elem()
+
+	r := httpCtx.Request
+	if r == nil {
+		return errors.New("bind: nil request")
+	}
+
+	err = bindValues(rv, r.URL.Query(), "query", "form", "json")
+	if err != nil {
+		return
+	}
+
+	contentType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	hasBody := r.Body != nil && r.Body != http.NoBody && r.ContentLength != 0
+	switch {
+	case contentType == "application/json" || strings.HasSuffix(contentType, "+json"):
+		if hasBody {
+			err = encoding.JSONIO.Unmarshal(r.Body, v)
+		}
+	case contentType == "application/xml" || contentType == "text/xml" || strings.HasSuffix(contentType, "+xml"):
+		if hasBody {
+			err = xml.NewDecoder(r.Body).Decode(v)
+		}
+	case contentType == "multipart/form-data":
+		if err = r.ParseMultipartForm(MaxMultipartMemory); err != nil {
+			break
+		}
+		if err = bindValues(rv, r.MultipartForm.Value, "form", "json"); err != nil {
+			break
+		}
+		err = bindFiles(rv, r.MultipartForm.File)
+	case contentType == "application/x-www-form-urlencoded":
+		if err = r.ParseForm(); err != nil {
+			break
+		}
+		err = bindValues(rv, r.PostForm, "form", "json")
+	}
+	if err != nil {
+		return fmt.Errorf("bind: %w", err)
+	}
+
+	if len(httpCtx.params) > 0 {
+		params := make(url.Values, len(httpCtx.params))
+		for key, value := range httpCtx.params {
+			params.Set(key, value)
+		}
+		err = bindValues(rv, params, "param")
+		if err != nil {
+			return
+		}
+	}
+
+	return validator.Struct(v)
+}
+
+//bindValues 按tags的顺序取字段对应的key，最后一个tag没有的时候用字段名
+//tags只有param的时候，不使用字段名
+func bindValues(rv reflect.Value, values url.Values, tags ...string) error {
+	if len(values) == 0 {
+		return nil
+	}
+	return walkFields(rv, tags, func(fv reflect.Value, key string) error {
+		vals, ok := values[key]
+		if !ok {
+			return nil
+		}
+		if err := setField(fv, vals); err != nil {
+			return fmt.Errorf("bind: %s %w", key, err)
+		}
+		return nil
+	})
+}
+
+func bindFiles(rv reflect.Value, files map[string][]*multipart.FileHeader) error {
+	if len(files) == 0 {
+		return nil
+	}
+	return walkFields(rv, []string{"form", "json"}, func(fv reflect.Value, key string) error {
+		list, ok := files[key]
+		if !ok || len(list) == 0 {
+			return nil
+		}
+		switch fv.Type() {
+		case fileHeaderType:
+			fv.Set(reflect.ValueOf(list[0]))
+		case fileHeaderSliceType:
+			fv.Set(reflect.ValueOf(list))
+		}
+		return nil
+	})
+}
+
+func walkFields(rv reflect.Value, tags []string, f func(fv reflect.Value, key string) error) error {
+	rt := rv.Type()
+	for i := 0; i < rt.NumField(); i++ {
+		sf := rt.Field(i)
+		fv := rv.Field(i)
+		if sf.Anonymous {
+			if fv.Kind() == reflect.Ptr && sf.Type.Elem().Kind() == reflect.Struct {
+				if fv.IsNil() {
+					if !fv.CanSet() {
+						continue
+					}
+					fv.Set(reflect.New(sf.Type.Elem()))
+				}
+				fv = fv.Elem()
+			}
+			if fv.Kind() == reflect.Struct {
+				if err := walkFields(fv, tags, f); err != nil {
+					return err
+				}
+				continue
+			}
+		}
+		if sf.PkgPath != "" || !fv.CanSet() {
+			continue
+		}
+
+		key := bindKey(sf, tags)
+		if key == "" {
+			continue
+		}
+		if err := f(fv, key); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func bindKey(sf reflect.StructField, tags []string) string {
+	for _, tag := range tags {
+		name := strings.Split(sf.Tag.Get(tag), ",")[0]
+		if name == "-" {
+			return ""
+		}
+		if name != "" {
+			return name
+		}
+	}
+	if len(tags) == 1 && tags[0] == "param" {
+		return ""
+	}
+
+	return sf.Name
+}
+
+func setField(fv reflect.Value, vals []string) error {
+	if fv.Type() == fileHeaderType || fv.Type() == fileHeaderSliceType {
+		return nil
+	}
+	switch fv.Kind() {
+	case reflect.Ptr:
+		if fv.IsNil() {
+			fv.Set(reflect.New(fv.Type().Elem()))
+		}
+		return setField(fv.Elem(), vals)
+	case reflect.Slice:
+		if fv.Type().Elem().Kind() == reflect.Uint8 {
+			//[]byte
+			fv.SetBytes([]byte(vals[0]))
+			return nil
+		}
+		slice := reflect.MakeSlice(fv.Type(), len(vals), len(vals))
+		for i, val := range vals {
+			if err := setValue(slice.Index(i), val); err != nil {
+				return err
+			}
+		}
+		fv.Set(slice)
+		return nil
+	}
+	if len(vals) == 0 {
+		return nil
+	}
+
+	return setValue(fv, vals[0])
+}
+
+func setValue(fv reflect.Value, val string) (err error) {
+	if fv.Type() == timeType {
+		if val == "" {
+			return nil
+		}
+		t, err := time.Parse(time.RFC3339, val)
+		if err != nil {
+			return err
+		}
+		fv.Set(reflect.ValueOf(t))
+		return nil
+	}
+
+	switch fv.Kind() {
+	case reflect.Ptr:
+		if fv.IsNil() {
+			fv.Set(reflect.New(fv.Type().Elem()))
+		}
+		return setValue(fv.Elem(), val)
+	case reflect.String:
+		fv.SetString(val)
+	case reflect.Bool:
+		if val == "" {
+			fv.SetBool(false)
+			return nil
+		}
+		b, err := strconv.ParseBool(val)
+		if err != nil {
+			return err
+		}
+		fv.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if val == "" {
+			fv.SetInt(0)
+			return nil
+		}
+		if fv.Type() == reflect.TypeOf(time.Duration(0)) {
+			d, err := time.ParseDuration(val)
+			if err != nil {
+				return err
+			}
+			fv.SetInt(int64(d))
+			return nil
+		}
+		n, err := strconv.ParseInt(val, 10, fv.Type().Bits())
+		if err != nil {
+			return err
+		}
+		fv.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		if val == "" {
+			fv.SetUint(0)
+			return nil
+		}
+		n, err := strconv.ParseUint(val, 10, fv.Type().Bits())
+		if err != nil {
+			return err
+		}
+		fv.SetUint(n)
+	case reflect.Float32, reflect.Float64:
+		if val == "" {
+			fv.SetFloat(0)
+			return nil
+		}
+		f, err := strconv.ParseFloat(val, fv.Type().Bits())
+		if err != nil {
+			return err
+		}
+		fv.SetFloat(f)
+	default:
+		return fmt.Errorf("unsupported type %s", fv.Type())
+	}
+
+	return nil
+}
@@ -0,0 +1,42 @@
+package hfw
+
+import (
+	"bytes"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/hsyan2008/hfw/validator"
+)
+
+type bindRequest struct {
+	ID     int64    `param:"id" validate:"required"`
+	Page   int      `query:"page" validate:"min=1"`
+	Name   string   `json:"name" validate:"required"`
+	Tags   []string `form:"tag"`
+	Format string
+}
+
+func TestShouldBind(t *testing.T) {
+	r := httptest.NewRequest("POST", "/user/10?page=2&tag=a&tag=b&Format=json",
+		bytes.NewBufferString(`{"name":"hfw"}`))
+	r.Header.Set("Content-Type", "application/json; charset=utf-8")
+	httpCtx := &HTTPContext{Request: r, params: map[string]string{"id": "10"}}
+
+	var req bindRequest
+	if err := httpCtx.ShouldBind(&req); err != nil {
+		t.Fatal(err)
+	}
+	if req.ID != 10 || req.Page != 2 || req.Name != "hfw" || len(req.Tags) != 2 || req.Format != "json" {
+		t.Errorf("error bind: %+v", req)
+	}
+
+	r = httptest.NewRequest("POST", "/user?page=0", bytes.NewBufferString("tag=a"))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	httpCtx = &HTTPContext{Request: r}
+	req = bindRequest{}
+	err := httpCtx.ShouldBind(&req)
+	errs, ok := err.(validator.Errors)
+	if !ok || len(errs) != 3 || len(req.Tags) != 1 {
+		t.Errorf("error validate: %v %+v", err, req)
+	}
+}
@@ -32,6 +32,9 @@ func ParseFlag() (err error) {
 	flag.CommandLine.StringVar(&ENVIRONMENT, "e", "", "set env, e.g dev test prod")
 	var p bool
 	flag.CommandLine.BoolVar(&p, "p", false, "print version")
+	configSets = nil
+	flag.CommandLine.Var(&configSets, "set", "override config, e.g -set Db.Port=3307, can be repeated")
+	flag.CommandLine.BoolVar(&dumpConfig, "dump-config", false, "print the effective config with secrets masked")
 
 	loadFlag()
 
@@ -139,6 +142,33 @@ var (
 	HOSTNAME, _ = os.Hostname()
 )
 
+//stringsFlag 可以重复的flag
+type stringsFlag []string
+
+func (s *stringsFlag) String() string {
+	return strings.Join(*s, ",")
+}
+
+func (s *stringsFlag) Set(value string) error {
+	*s = append(*s, value)
+	return nil
+}
+
+var (
+	configSets stringsFlag
+	dumpConfig bool
+)
+
+//GetConfigSets 命令行-set的配置，按顺序，如Db.Port=3307
+func GetConfigSets() []string {
+	return configSets
+}
+
+//IsDumpConfig 命令行是否指定了-dump-config
+func IsDumpConfig() bool {
+	return dumpConfig
+}
+
 func GetVersion() string {
 	return VERSION
 }
@@ -0,0 +1,249 @@
+package hfw
+
+import (
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/andybalholm/brotli"
+	"github.com/hsyan2008/hfw/configs"
+)
+
+const defaultCompressMinLength = 1024
+
+//NoCompressTypes 不压缩的Content-Type前缀，一般是已经压缩过的内容
+var NoCompressTypes = []string{
+	"image/",
+	"video/",
+	"audio/",
+	"font/woff",
+	"application/zip",
+	"application/gzip",
+	"application/x-gzip",
+	"application/x-bzip2",
+	"application/x-xz",
+	"application/x-7z-compressed",
+	"application/x-rar-compressed",
+	"application/pdf",
+}
+
+//svg是文本，可以压缩
+var compressibleImageTypes = []string{"image/svg+xml"}
+
+//协商的时候q值相同，按这个顺序优先
+var compressEncodings = []string{"br", "gzip", "deflate"}
+
+type compressor interface {
+	io.WriteCloser
+	Reset(w io.Writer)
+}
+
+var compressPools = map[string]*sync.Pool{
+	"br": {New: func() interface{} {
+		return brotli.NewWriterLevel(nil, brotli.DefaultCompression)
+	}},
+	"gzip": {New: func() interface{} {
+		return gzip.NewWriter(nil)
+	}},
+	//http的deflate实际是zlib格式
+	"deflate": {New: func() interface{} {
+		return zlib.NewWriter(nil)
+	}},
+}
+
+//negotiateEncoding 按Accept-Encoding的q值选择压缩算法，返回空表示不压缩
+func negotiateEncoding(acceptEncoding string) string {
+	if acceptEncoding == "" {
+		return ""
+	}
+
+	qs := make(map[string]float64)
+	for _, item := range strings.Split(acceptEncoding, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		name, q := item, 1.0
+		if i := strings.Index(item, ";"); i >= 0 {
+			name = strings.TrimSpace(item[:i])
+			param := strings.TrimSpace(item[i+1:])
+			if strings.HasPrefix(param, "q=") {
+				f, err := strconv.ParseFloat(param[2:], 64)
+				if err != nil {
+					continue
+				}
+				q = f
+			}
+		}
+		qs[strings.ToLower(name)] = q
+	}
+
+	var (
+		encoding string
+		maxQ     float64
+	)
+	for _, name := range compressEncodings {
+		q, ok := qs[name]
+		if !ok {
+			//*匹配没有列出来的算法
+			if q, ok = qs["*"]; !ok {
+				continue
+			}
+		}
+		if q > maxQ {
+			encoding, maxQ = name, q
+		}
+	}
+
+	return encoding
+}
+
+//isCompressibleType 判断Content-Type是否需要压缩
+func isCompressibleType(contentType string) bool {
+	t, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		t = strings.ToLower(strings.TrimSpace(contentType))
+	}
+	for _, v := range compressibleImageTypes {
+		if t == v {
+			return true
+		}
+	}
+	for _, list := range [][]string{NoCompressTypes, configs.Get().Server.Compress.ExcludeTypes} {
+		for _, v := range list {
+			if strings.HasPrefix(t, strings.ToLower(v)) {
+				return false
+			}
+		}
+	}
+
+	return true
+}
+
+//isCompress 是否按协商的算法压缩输出
+func (httpCtx *HTTPContext) isCompress() bool {
+	return httpCtx.IsZip && httpCtx.ContentEncoding != "" &&
+		!configs.Get().Server.Compress.IsDisable
+}
+
+//addVary 设置Vary，已存在的不重复添加
+func addVary(header http.Header, value string) {
+	for _, v := range header.Values("Vary") {
+		for _, item := range strings.Split(v, ",") {
+			if strings.EqualFold(strings.TrimSpace(item), value) {
+				return
+			}
+		}
+	}
+	header.Add("Vary", value)
+}
+
+//newCompressWriter 返回输出body的writer，写完必须Close
+//需要压缩的时候，先缓存MinLength长度的内容，超过了再压缩，所以状态码在第一次输出时才写入
+//Content-Type不需要压缩或者已经有Content-Encoding的时候，直接输出
+func (httpCtx *HTTPContext) newCompressWriter() io.WriteCloser {
+	cw := &compressWriter{
+		rw:     httpCtx.ResponseWriter,
+		status: httpCtx.HTTPStatus,
+	}
+	c := configs.Get().Server.Compress
+	if !c.IsDisable {
+		addVary(cw.rw.Header(), "Accept-Encoding")
+	}
+	header := cw.rw.Header()
+	if !httpCtx.isCompress() || header.Get("Content-Encoding") != "" ||
+		!isCompressibleType(header.Get("Content-Type")) {
+		_ = cw.start(false)
+		return cw
+	}
+
+	cw.encoding = httpCtx.ContentEncoding
+	cw.minLength = c.MinLength
+	if cw.minLength <= 0 {
+		cw.minLength = defaultCompressMinLength
+	}
+
+	return cw
+}
+
+type compressWriter struct {
+	rw        http.ResponseWriter
+	status    int
+	encoding  string
+	minLength int
+
+	//是否已经写入状态码
+	started bool
+	buf     []byte
+	w       compressor
+}
+
+func (cw *compressWriter) Write(p []byte) (int, error) {
+	if cw.started {
+		if cw.w != nil {
+			return cw.w.Write(p)
+		}
+		return cw.rw.Write(p)
+	}
+
+	cw.buf = append(cw.buf, p...)
+	if len(cw.buf) < cw.minLength {
+		return len(p), nil
+	}
+	if err := cw.start(true); err != nil {
+		return 0, err
+	}
+
+	return len(p), nil
+}
+
+//start 写入header和状态码，并输出已缓存的内容
+func (cw *compressWriter) start(isCompress bool) (err error) {
+	cw.started = true
+	if isCompress {
+		header := cw.rw.Header()
+		header.Del("Content-Length")
+		header.Set("Content-Encoding", cw.encoding)
+		//压缩后的内容和原内容不一样，使用弱ETag
+		if etag := header.Get("ETag"); etag != "" && !strings.HasPrefix(etag, "W/") {
+			header.Set("ETag", "W/"+etag)
+		}
+		cw.w = compressPools[cw.encoding].Get().(compressor)
+		cw.w.Reset(cw.rw)
+	}
+	cw.rw.WriteHeader(cw.status)
+
+	if len(cw.buf) == 0 {
+		return
+	}
+	buf := cw.buf
+	cw.buf = nil
+	if cw.w != nil {
+		_, err = cw.w.Write(buf)
+	} else {
+		_, err = cw.rw.Write(buf)
+	}
+
+	return
+}
+
+func (cw *compressWriter) Close() (err error) {
+	if !cw.started {
+		//内容太少，不压缩
+		return cw.start(false)
+	}
+	if cw.w == nil {
+		return
+	}
+	err = cw.w.Close()
+	cw.w.Reset(nil)
+	compressPools[cw.encoding].Put(cw.w)
+	cw.w = nil
+
+	return
+}
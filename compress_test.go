@@ -0,0 +1,86 @@
+package hfw
+
+import (
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/andybalholm/brotli"
+)
+
+func TestNegotiateEncoding(t *testing.T) {
+	for accept, expect := range map[string]string{
+		"":                          "",
+		"gzip, deflate":             "gzip",
+		"gzip, deflate, br":         "br",
+		"br;q=0.5, gzip":            "gzip",
+		"deflate":                   "deflate",
+		"br;q=0, *":                 "gzip",
+		"identity":                  "",
+		"*;q=0":                     "",
+		"GZIP;q=0.8, deflate;q=0.9": "deflate",
+	} {
+		if got := negotiateEncoding(accept); got != expect {
+			t.Errorf("%q: expect %q, got %q", accept, expect, got)
+		}
+	}
+}
+
+func TestCompressWriter(t *testing.T) {
+	body := strings.Repeat("hfw compress ", 200)
+	serve := func(encoding, contentType, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		httpCtx := &HTTPContext{ResponseWriter: w, HTTPStatus: http.StatusOK, IsZip: true, ContentEncoding: encoding}
+		w.Header().Set("Content-Type", contentType)
+		cw := httpCtx.newCompressWriter()
+		//分多次写入
+		for i := 0; i < len(body); i += 100 {
+			end := i + 100
+			if end > len(body) {
+				end = len(body)
+			}
+			if _, err := cw.Write([]byte(body[i:end])); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := cw.Close(); err != nil {
+			t.Fatal(err)
+		}
+		return w
+	}
+
+	w := serve("br", "text/html", body)
+	if w.Header().Get("Content-Encoding") != "br" || w.Header().Get("Vary") != "Accept-Encoding" {
+		t.Fatalf("br: %v", w.Header())
+	}
+	b, err := io.ReadAll(brotli.NewReader(w.Body))
+	if err != nil || string(b) != body {
+		t.Errorf("br body: %v", err)
+	}
+
+	w = serve("gzip", "application/json", body)
+	if w.Header().Get("Content-Encoding") != "gzip" {
+		t.Fatalf("gzip: %v", w.Header())
+	}
+	r, err := gzip.NewReader(w.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err = io.ReadAll(r)
+	if err != nil || string(b) != body {
+		t.Errorf("gzip body: %v", err)
+	}
+
+	w = serve("gzip", "text/plain", "small")
+	if w.Header().Get("Content-Encoding") != "" || w.Body.String() != "small" || w.Code != http.StatusOK {
+		t.Errorf("small: %v %s", w.Header(), w.Body.String())
+	}
+
+	w = serve("gzip", "image/png", body)
+	if w.Header().Get("Content-Encoding") != "" || w.Body.String() != body {
+		t.Errorf("image: %v", w.Header())
+	}
+}
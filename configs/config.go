@@ -4,6 +4,7 @@ import (
 	"time"
 )
 
+//Config 启动时加载的配置，Reload不会修改，运行中请使用Get获取最新的配置
 var Config AllConfig
 
 //Config 项目配置
@@ -23,7 +24,49 @@ type AllConfig struct {
 	Redis      RedisConfig
 	Session    SessionConfig
 	Prometheus PrometheusConfig
-	Custom     map[string]string
+	Limit      LimitConfig
+	Cors       CorsConfig
+	Csrf       CsrfConfig
+	Trace      TraceConfig
+	//panic和5xx的上报
+	ErrorReport ErrorReportConfig
+	Health      HealthConfig
+	Reload      ReloadConfig
+	Custom      map[string]string
+}
+
+//HealthConfig 健康检查，LivePath只表示进程存活，ReadyPath执行注册的检查
+//开启后grpc服务也提供grpc.health.v1
+type HealthConfig struct {
+	IsEnable bool
+	//默认/healthz
+	LivePath string
+	//默认/readyz
+	ReadyPath string
+	//每个检查的超时时间，默认3秒
+	Timeout time.Duration
+	//退出的时候readiness先返回失败，等待这么久再停止接收请求，让负载均衡摘除流量
+	ShutdownDelay time.Duration
+}
+
+//ReloadConfig 配置热加载，没有HTTP服务的时候SIGHUP也会重新加载(HTTP服务的SIGHUP用于平滑重启)
+type ReloadConfig struct {
+	//检查配置文件修改的间隔，0表示不检查
+	WatchInterval time.Duration
+	//POST这个路径重新加载配置，为空表示不开启
+	//Token为空的时候只允许本机访问，否则需要Header：Authorization: Bearer Token，经过本机的反向代理的时候请设置Token
+	AdminPath string
+	Token     string
+}
+
+//ErrorReportConfig 内置的错误上报，也可以通过hfw.OnError注册自定义的
+type ErrorReportConfig struct {
+	//webhook地址，按间隔合并相同的错误后POST json数组
+	WebhookURL string
+	//webhook的合并间隔，默认1分钟
+	WebhookInterval time.Duration
+	//本地文件，每个错误一行json
+	FilePath string
 }
 
 type RedisConfig struct {
@@ -46,14 +89,100 @@ type SessionConfig struct {
 	Expiration int64
 }
 
+//TraceConfig 链路追踪，使用W3C traceparent传递
+type TraceConfig struct {
+	IsEnable bool
+	//otlp、stdout、file，默认stdout
+	Exporter string
+	//otlp的grpc地址，如127.0.0.1:4317
+	Endpoint string
+	//otlp不使用tls
+	Insecure bool
+	//file的文件路径，默认是日志文件所在目录下的应用名.trace，没有日志文件的时候是程序所在目录
+	FilePath string
+	//采样比例，0-1，默认1，有上游的时候跟随上游
+	SampleRatio float64
+}
+
+//CsrfConfig csrf校验，token保存在session里，需要开启session
+type CsrfConfig struct {
+	IsEnable bool
+	//表单字段名，默认_csrf
+	FieldName string
+	//header名，默认X-CSRF-Token，ajax请求使用
+	HeaderName string
+	//不校验的路由前缀，如第三方回调
+	ExemptPaths []string
+}
+
 type PrometheusConfig struct {
 	IsEnable         bool
 	RoutePath        string   //注册路由，供prometheus拉取数据
 	RequestsTotal    string   //默认requests_total
 	RequestsCosttime string   //默认requests_costtime
+	RequestsErrors   string   //默认requests_errors_total
+	LimitRejected    string   //默认limit_rejected_total
+	LimitInflight    string   //默认limit_inflight
+	LimitAdaptive    string   //默认limit_adaptive
 	Tags             []string //默认prometheus
 }
 
+//LimitConfig 按路由限流和限制并发，多条规则匹配的时候都生效
+type LimitConfig struct {
+	Rules    []LimitRule
+	Adaptive AdaptiveLimitConfig
+	//可信的代理，ip或者CIDR，KeyBy是ip的时候，只有RemoteAddr是可信的代理才从X-Forwarded-For里取客户端ip
+	TrustedProxies []string
+}
+
+//AdaptiveLimitConfig 根据延迟和cpu自动调整允许的并发，对http和grpc的请求生效，grpc的Stream除外
+type AdaptiveLimitConfig struct {
+	IsEnable bool
+	//初始并发，默认20
+	InitLimit int
+	//最小并发，默认1
+	MinLimit int
+	//最大并发，默认1000
+	MaxLimit int
+	//延迟容忍倍数，短期延迟超过长期延迟的这个倍数后减少并发，默认1.5
+	Tolerance float64
+	//进程cpu使用率(0-100)超过后拒绝新请求，0表示不检查
+	CPUThreshold float64
+}
+
+//LimitRule 限流规则
+type LimitRule struct {
+	//路由前缀，按段匹配，不区分大小写，grpc下是FullMethod，空表示所有请求
+	Path string
+	//请求方法，如GET、POST，grpc下是GRPC、Stream，空表示所有方法
+	Method string
+	//最大并发，0表示不限制
+	Concurrence uint
+	//每秒请求数，0表示不限制
+	Rate float64
+	//令牌桶容量，默认是Rate向上取整
+	Burst int
+	//限流的维度，默认是整条规则共享
+	//route表示每个路由单独计算，ip表示每个客户端ip单独计算，其他的是hfw.RegisterLimitKeyFunc注册的名字
+	KeyBy string
+}
+
+//CorsConfig 跨域配置，开启后自动响应已注册路由的预检请求
+type CorsConfig struct {
+	IsEnable bool
+	//允许的Origin，支持一个*通配，如https://*.example.com，*表示所有
+	AllowOrigins []string
+	//默认GET、POST、PUT、PATCH、DELETE、HEAD
+	AllowMethods []string
+	//默认或者包含*的时候，使用请求的Access-Control-Request-Headers
+	AllowHeaders  []string
+	ExposeHeaders []string
+	//允许携带cookie，此时Allow-Origin返回请求的Origin
+	AllowCredentials bool
+	//预检结果缓存的秒数，0表示不返回
+	MaxAge int
+}
+
 //ServerConfig ..
 type ServerConfig struct {
 	Address string
@@ -89,6 +218,38 @@ type HTTPServerConfig struct {
 
 	ReadTimeout  time.Duration
 	WriteTimeout time.Duration
+
+	//GET请求的json和模板输出是否计算ETag，可以通过httpCtx.IsETag修改
+	IsETag bool
+
+	Compress CompressConfig
+
+	//请求的默认超时时间，0表示不限制，超时返回504，grpc也使用这个配置
+	Timeout time.Duration
+	//按路由设置超时时间，最长匹配的生效
+	RouteTimeouts []RouteTimeout
+
+	//退出的总超时时间，默认30秒，超时后打印所有goroutine的堆栈并退出，grpc也使用这个配置
+	ShutdownTimeout time.Duration
+}
+
+//RouteTimeout 路由的超时时间
+type RouteTimeout struct {
+	//路由前缀，按段匹配，不区分大小写，grpc下是FullMethod
+	Path string
+	//请求方法，空表示所有方法
+	Method string
+	//0表示不限制
+	Timeout time.Duration
+}
+
+//CompressConfig 输出压缩，按Accept-Encoding协商br、gzip、deflate
+type CompressConfig struct {
+	IsDisable bool
+	//小于这个长度的body不压缩，默认1024
+	MinLength int
+	//不压缩的Content-Type前缀，在内置的图片、视频、压缩包等类型之外追加
+	ExcludeTypes []string
 }
 
 //GrpcServerConfig ..
@@ -106,6 +267,13 @@ type LoggerConfig struct {
 	LogMaxNum int32
 	LogSize   int64
 	LogUnit   string
+
+	//访问日志的文件，空表示不记录，http、HandlerFunc和grpc每个请求一行
+	AccessLogFile string
+	//json、combined(Apache)或者combined+trace(combined后面追加trace_id和耗时)，默认json
+	AccessLogFormat string
+	//daily或者roll，默认daily，roll的时候使用LogMaxNum、LogSize、LogUnit
+	AccessLogType string
 }
 
 //DbConfig ..
@@ -155,6 +323,14 @@ type TemplateConfig struct {
 	HTMLPath    string
 	WidgetsPath string
 	IsCache     bool
+	//默认的layout，相对HTMLPath，可以通过httpCtx.Layout修改
+	Layout string
+	//模板文件修改后自动清空缓存，开发环境和go run下自动开启
+	IsWatch bool
+	//浏览器访问出错时的模板，相对HTMLPath，key是状态码，如"404" = "error/404.html"
+	ErrorPages map[string]string
+	//ErrorPages里没有对应状态码时的模板，空表示按原来的方式输出
+	ErrorPage string
 }
 
 //RouteConfig ..
@@ -0,0 +1,206 @@
+package configs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/hsyan2008/go-logger"
+	"github.com/hsyan2008/hfw/common"
+)
+
+//当前配置的快照，LoadDefaultConfig和Reload的时候替换
+var current atomic.Value
+
+var (
+	reloadMu    sync.Mutex
+	validators  []func(*AllConfig) error
+	subscribers []*subscriber
+)
+
+type subscriber struct {
+	section string
+	f       func(old, new *AllConfig)
+}
+
+//Get 返回当前配置的快照，并发安全，Reload后返回新的配置，请不要修改
+func Get() *AllConfig {
+	if c, ok := current.Load().(*AllConfig); ok {
+		return c
+	}
+
+	return &Config
+}
+
+//Set 直接替换当前配置的快照，返回原来的，不校验也不通知订阅者，一般用于测试
+func Set(c *AllConfig) (old *AllConfig) {
+	reloadMu.Lock()
+	defer reloadMu.Unlock()
+	old = Get()
+	current.Store(c)
+
+	return
+}
+
+//RegisterValidator 注册配置的校验，Reload的时候任意一个返回error就放弃这次加载
+func RegisterValidator(f func(*AllConfig) error) {
+	reloadMu.Lock()
+	defer reloadMu.Unlock()
+	validators = append(validators, f)
+}
+
+//Subscribe 订阅配置的变化，section是AllConfig的字段，可以用.分隔，如Logger、Server.Concurrence、Custom
+//section为空表示任意变化，只有section的值变化的时候才调用f，按注册的顺序在Reload里执行
+func Subscribe(section string, f func(old, new *AllConfig)) {
+	if section != "" && !getSection(&Config, section).IsValid() {
+		panic("undefined config section: " + section)
+	}
+	reloadMu.Lock()
+	defer reloadMu.Unlock()
+	subscribers = append(subscribers, &subscriber{section: section, f: f})
+}
+
+func getSection(c *AllConfig, section string) (v reflect.Value) {
+	v = reflect.ValueOf(c).Elem()
+	for _, name := range strings.Split(section, ".") {
+		if v.Kind() != reflect.Struct {
+			return reflect.Value{}
+		}
+		v = v.FieldByName(name)
+		if !v.IsValid() {
+			return
+		}
+	}
+
+	return
+}
+
+//Reload 重新加载配置文件，校验通过后替换当前配置，并通知订阅者
+func Reload() (err error) {
+	reloadMu.Lock()
+	defer reloadMu.Unlock()
+
+	c := new(AllConfig)
+	err = Load(c)
+	if err != nil {
+		return
+	}
+	err = initDefaultConfig(c)
+	if err != nil {
+		return
+	}
+	err = validate(c)
+	if err != nil {
+		return
+	}
+
+	old := Get()
+	current.Store(c)
+	logger.Info("config reloaded")
+
+	for _, s := range subscribers {
+		if s.section == "" {
+			if reflect.DeepEqual(old, c) {
+				continue
+			}
+		} else if reflect.DeepEqual(getSection(old, s.section).Interface(), getSection(c, s.section).Interface()) {
+			continue
+		}
+		notify(s, old, c)
+	}
+
+	return
+}
+
+func notify(s *subscriber, old, c *AllConfig) {
+	defer func() {
+		if err := recover(); err != nil {
+			logger.Warn("config subscriber panic:", s.section, err, string(common.GetStack()))
+		}
+	}()
+	s.f(old, c)
+}
+
+//validate 内置的校验和RegisterValidator注册的校验
+func validate(c *AllConfig) (err error) {
+	lc := c.Logger
+	if lc.LogFile != "" {
+		switch strings.ToLower(lc.LogType) {
+		case "daily", "roll":
+		default:
+			return errors.New("undefined logtype: " + lc.LogType)
+		}
+	}
+	switch strings.ToLower(lc.AccessLogFormat) {
+	case "", "json", "combined", "combined+trace":
+	default:
+		return errors.New("undefined access log format: " + lc.AccessLogFormat)
+	}
+	switch strings.ToLower(lc.AccessLogType) {
+	case "", "daily", "roll":
+	default:
+		return errors.New("undefined access log type: " + lc.AccessLogType)
+	}
+	if c.Redis.PoolSize < 0 {
+		return fmt.Errorf("invalid redis pool size: %d", c.Redis.PoolSize)
+	}
+
+	for _, f := range validators {
+		err = f(c)
+		if err != nil {
+			return
+		}
+	}
+
+	return
+}
+
+//Watch 每隔interval检查一次配置文件，有修改、新增或者删除的时候Reload，ctx结束的时候返回
+func Watch(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	last := configFiles()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			files := configFiles()
+			if reflect.DeepEqual(files, last) {
+				continue
+			}
+			last = files
+			if err := Reload(); err != nil {
+				logger.Warn("reload config:", err)
+			}
+		}
+	}
+}
+
+//configFiles Load会加载的文件和修改时间
+func configFiles() map[string]time.Time {
+	configPath := filepath.Join(common.GetAppPath(), "config")
+	dirs := []string{common.GetAppPath(), configPath}
+	if len(common.GetEnv()) > 0 {
+		dirs = append(dirs, filepath.Join(configPath, common.GetEnv()))
+	}
+
+	files := make(map[string]time.Time)
+	for _, dir := range dirs {
+		list, _ := filepath.Glob(filepath.Join(dir, "*.toml"))
+		for _, file := range list {
+			if fi, err := os.Stat(file); err == nil {
+				files[file] = fi.ModTime()
+			}
+		}
+	}
+
+	return files
+}
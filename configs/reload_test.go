@@ -0,0 +1,58 @@
+package configs
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestReload(t *testing.T) {
+	defer func() {
+		validators, subscribers = nil, nil
+	}()
+
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Error("undefined section should panic")
+			}
+		}()
+		Subscribe("Server.NotExist", nil)
+	}()
+
+	old := &AllConfig{}
+	old.Server.Concurrence = 10
+	defer Set(Set(old))
+	concurrence := Config.Server.Concurrence
+
+	var changed []string
+	for _, section := range []string{"", "Server.Concurrence", "Logger", "Custom"} {
+		section := section
+		Subscribe(section, func(o, n *AllConfig) {
+			if o != old || n != Get() {
+				t.Errorf("%s: wrong old or new config", section)
+			}
+			changed = append(changed, section)
+		})
+	}
+	Subscribe("Redis", func(o, n *AllConfig) {
+		panic("should recover")
+	})
+
+	RegisterValidator(func(c *AllConfig) error {
+		return errors.New("invalid")
+	})
+	if err := Reload(); err == nil || Get() != old {
+		t.Fatalf("validator: %v", err)
+	}
+
+	validators = nil
+	if err := Reload(); err != nil {
+		t.Fatal(err)
+	}
+	if Get() == old || Get().Server.Concurrence != 0 || Config.Server.Concurrence != concurrence {
+		t.Errorf("config not swapped: %+v", Get().Server)
+	}
+	if len(changed) != 2 || changed[0] != "" || changed[1] != "Server.Concurrence" {
+		t.Errorf("changed: %v", changed)
+	}
+}
@@ -6,13 +6,24 @@ import (
 	"math"
 	"path/filepath"
 	"strings"
+	"time"
 
 	"github.com/BurntSushi/toml"
 	"github.com/hsyan2008/go-logger"
 	"github.com/hsyan2008/hfw/common"
 )
 
+//Load 依次加载当前目录、config、config/环境下的toml，再用环境变量和命令行-set覆盖
 func Load(config interface{}) (err error) {
+	err = loadFiles(config)
+	if err != nil {
+		return
+	}
+
+	return applyOverrides(config, common.GetConfigSets())
+}
+
+func loadFiles(config interface{}) (err error) {
 	var configList []string
 	defer func() {
 		logger.Info("load config list:", configList)
@@ -75,47 +86,54 @@ func LoadDefaultConfig() (err error) {
 	if err != nil {
 		return
 	}
-	return initDefaultConfig()
+	err = initDefaultConfig(&Config)
+	if err != nil {
+		return
+	}
+	c := Config
+	current.Store(&c)
+
+	return
 }
 
-func initDefaultConfig() error {
+func initDefaultConfig(c *AllConfig) error {
 
 	//错误码基数，如果小于10就认为是位数
-	if Config.ErrorBase == 0 {
-		Config.ErrorBase = 6
+	if c.ErrorBase == 0 {
+		c.ErrorBase = 6
 	}
-	if Config.ErrorBase < 10 {
-		Config.ErrorBase = int64(math.Pow10(int(Config.ErrorBase)))
+	if c.ErrorBase < 10 {
+		c.ErrorBase = int64(math.Pow10(int(c.ErrorBase)))
 	}
 
 	//设置默认路由
-	if len(Config.Route.DefaultController) == 0 {
-		Config.Route.DefaultController = "index"
+	if len(c.Route.DefaultController) == 0 {
+		c.Route.DefaultController = "index"
 	} else {
-		Config.Route.DefaultController = strings.ToLower(Config.Route.DefaultController)
+		c.Route.DefaultController = strings.ToLower(c.Route.DefaultController)
 	}
-	if len(Config.Route.DefaultAction) == 0 {
-		Config.Route.DefaultAction = "index"
+	if len(c.Route.DefaultAction) == 0 {
+		c.Route.DefaultAction = "index"
 	} else {
-		Config.Route.DefaultAction = strings.ToLower(Config.Route.DefaultAction)
+		c.Route.DefaultAction = strings.ToLower(c.Route.DefaultAction)
 	}
 
 	//转为绝对路径
-	if !filepath.IsAbs(Config.Template.HTMLPath) {
-		Config.Template.HTMLPath = filepath.Join(common.GetAppPath(), Config.Template.HTMLPath)
+	if !filepath.IsAbs(c.Template.HTMLPath) {
+		c.Template.HTMLPath = filepath.Join(common.GetAppPath(), c.Template.HTMLPath)
 	}
-	if len(Config.Template.WidgetsPath) > 0 {
-		if !filepath.IsAbs(Config.Template.WidgetsPath) {
-			Config.Template.WidgetsPath = filepath.Join(common.GetAppPath(), Config.Template.WidgetsPath)
+	if len(c.Template.WidgetsPath) > 0 {
+		if !filepath.IsAbs(c.Template.WidgetsPath) {
+			c.Template.WidgetsPath = filepath.Join(common.GetAppPath(), c.Template.WidgetsPath)
 		}
-		m, err := filepath.Glob(Config.Template.WidgetsPath)
+		m, err := filepath.Glob(c.Template.WidgetsPath)
 		if err != nil || len(m) == 0 {
 			return errors.New("error WidgetsPath")
 		}
 	}
 
-	certFile := Config.Server.CertFile
-	keyFile := Config.Server.KeyFile
+	certFile := c.Server.CertFile
+	keyFile := c.Server.KeyFile
 	if len(certFile) > 0 && len(keyFile) > 0 {
 		if !filepath.IsAbs(certFile) {
 			certFile = filepath.Join(common.GetAppPath(), certFile)
@@ -125,46 +143,71 @@ func initDefaultConfig() error {
 			keyFile = filepath.Join(common.GetAppPath(), keyFile)
 		}
 	}
-	Config.Server.CertFile = certFile
-	Config.Server.KeyFile = keyFile
+	c.Server.CertFile = certFile
+	c.Server.KeyFile = keyFile
 
 	//session
-	if Config.EnableSession {
-		if Config.Session.CookieName == "" {
-			Config.Session.CookieName = "sessionid"
+	if c.EnableSession {
+		if c.Session.CookieName == "" {
+			c.Session.CookieName = "sessionid"
 		}
-		if Config.Session.CacheType == "" {
-			Config.Session.CacheType = "redis"
+		if c.Session.CacheType == "" {
+			c.Session.CacheType = "redis"
 		}
 	}
 
 	//redis
-	if len(Config.Redis.Addresses) == 0 && Config.Redis.Server != "" {
-		Config.Redis.Addresses = []string{Config.Redis.Server}
+	if len(c.Redis.Addresses) == 0 && c.Redis.Server != "" {
+		c.Redis.Addresses = []string{c.Redis.Server}
+	}
+
+	//健康检查
+	if c.Health.IsEnable {
+		if c.Health.LivePath == "" {
+			c.Health.LivePath = "/healthz"
+		}
+		if c.Health.ReadyPath == "" {
+			c.Health.ReadyPath = "/readyz"
+		}
+		if c.Health.Timeout <= 0 {
+			c.Health.Timeout = 3 * time.Second
+		}
 	}
 
 	//prometheus
-	if Config.Prometheus.IsEnable {
-		if Config.Prometheus.RequestsTotal == "" {
-			Config.Prometheus.RequestsTotal = "requests_total"
+	if c.Prometheus.IsEnable {
+		if c.Prometheus.RequestsTotal == "" {
+			c.Prometheus.RequestsTotal = "requests_total"
+		}
+		if c.Prometheus.RequestsCosttime == "" {
+			c.Prometheus.RequestsCosttime = "requests_costtime"
+		}
+		if c.Prometheus.RequestsErrors == "" {
+			c.Prometheus.RequestsErrors = "requests_errors_total"
+		}
+		if c.Prometheus.LimitRejected == "" {
+			c.Prometheus.LimitRejected = "limit_rejected_total"
+		}
+		if c.Prometheus.LimitInflight == "" {
+			c.Prometheus.LimitInflight = "limit_inflight"
 		}
-		if Config.Prometheus.RequestsCosttime == "" {
-			Config.Prometheus.RequestsCosttime = "requests_costtime"
+		if c.Prometheus.LimitAdaptive == "" {
+			c.Prometheus.LimitAdaptive = "limit_adaptive"
 		}
-		if Config.Prometheus.RoutePath == "" {
-			Config.Prometheus.RoutePath = "/metrics"
+		if c.Prometheus.RoutePath == "" {
+			c.Prometheus.RoutePath = "/metrics"
 		}
-		if len(Config.Prometheus.Tags) == 0 {
-			Config.Prometheus.Tags = append(Config.Prometheus.Tags, "prometheus")
+		if len(c.Prometheus.Tags) == 0 {
+			c.Prometheus.Tags = append(c.Prometheus.Tags, "prometheus")
 		}
 	FOR:
-		for _, val := range Config.Prometheus.Tags {
-			for _, v := range Config.Server.Tags {
+		for _, val := range c.Prometheus.Tags {
+			for _, v := range c.Server.Tags {
 				if val == v {
 					continue FOR
 				}
 			}
-			Config.Server.Tags = append(Config.Server.Tags, val)
+			c.Server.Tags = append(c.Server.Tags, val)
 		}
 	}
 
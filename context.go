@@ -9,22 +9,28 @@ import (
 	"net/http"
 	"strconv"
 	"strings"
+	"sync/atomic"
 	"time"
 
 	logger "github.com/hsyan2008/go-logger"
 	"github.com/hsyan2008/hfw/common"
+	"github.com/hsyan2008/hfw/configs"
 	"github.com/hsyan2008/hfw/session"
 	"github.com/hsyan2008/hfw/signal"
+	"github.com/hsyan2008/hfw/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
 )
 
 //HTTPContext ..
 //渲染模板的数据放Data
 //Json里的数据放Response
-//Layout的功能未实现 TODO
+//Layout是包裹模板的文件，默认是Template.Layout，设置为空则不使用
 type HTTPContext struct {
 	Ctx        context.Context    `json:"-"`
 	cancel     context.CancelFunc `json:"-"`
-	isCanceled bool               `json:"-"`
+	isCanceled int32              `json:"-"`
 
 	HTTPStatus int `json:"-"`
 
@@ -37,9 +43,17 @@ type HTTPContext struct {
 	//对应的struct方法的名称，大小写一致
 	Action string `json:"-"`
 	Path   string `json:"-"`
+	//匹配到的路由规则，如user/:id/orders/index
+	Route  string `json:"-"`
+	params map[string]string
 
+	//是否压缩输出，默认是客户端支持压缩的时候
 	IsZip bool `json:"-"`
-	//404和500页面被自动更改content-type，导致压缩后有问题，暂时不压缩
+	//协商出来的压缩算法，br、gzip、deflate
+	ContentEncoding string `json:"-"`
+	//json和模板输出是否计算ETag并处理If-None-Match，默认是Server.IsETag
+	IsETag bool `json:"-"`
+	//NotFound、ServerError等出错的时候为true，不计算ETag
 	IsError bool `json:"-"`
 
 	//html文本
@@ -51,6 +65,8 @@ type HTTPContext struct {
 	FuncMap map[string]interface{} `json:"-"`
 
 	IsJSON bool `json:"-"`
+	//根据format参数或Accept协商出的输出格式，如application/xml，空表示默认
+	MediaType string `json:"-"`
 	//返回的json是否包含Header
 	HasHeader bool `json:"-"`
 	//是否只返回Response.Results里的数据
@@ -63,6 +79,19 @@ type HTTPContext struct {
 
 	hijacked bool
 
+	//用于日志和监控，grpc下分别是FullMethod和GRPC、Stream
+	requestPath   string
+	requestMethod string
+	//匹配到的controller，NotFound的时候是默认controller
+	instance *instance
+	//http请求的server span，Router和HandlerFunc结束的时候关闭
+	span trace.Span
+	//经过MetricsMiddleware的时间，请求结束的时候记录监控
+	metricsStart time.Time
+	//recoverPanic捕获的panic和堆栈，用于开发环境的错误页面和错误上报
+	panicValue interface{}
+	panicStack []byte
+
 	*logger.Logger
 }
 
@@ -73,8 +102,10 @@ func initCtx(w http.ResponseWriter, r *http.Request) *HTTPContext {
 
 	httpCtx.HTTPStatus = http.StatusOK
 
-	httpCtx.ResponseWriter = w
+	httpCtx.ResponseWriter = newResponseWriter(w)
 	httpCtx.Request = r
+	httpCtx.requestPath = r.URL.Path
+	httpCtx.requestMethod = r.Method
 
 	httpCtx.Data = make(map[string]interface{})
 	httpCtx.FuncMap = make(map[string]interface{})
@@ -82,9 +113,35 @@ func initCtx(w http.ResponseWriter, r *http.Request) *HTTPContext {
 	httpCtx.Logger = logger.NewLogger()
 	httpCtx.SetTraceID(common.GetTraceIDFromRequest(r))
 
+	httpCtx.Ctx, httpCtx.span = tracing.Start(tracing.ExtractHTTP(httpCtx.Ctx, r.Header),
+		"HTTP "+r.Method, trace.SpanKindServer,
+		attribute.String("http.method", r.Method),
+		attribute.String("http.target", r.URL.Path),
+		attribute.String("http.user_agent", r.UserAgent()),
+		tracing.AttrTraceID.String(httpCtx.GetTraceID()),
+	)
+
 	return httpCtx
 }
 
+//endSpan 结束http请求的span，记录匹配到的路由和状态码
+func (httpCtx *HTTPContext) endSpan() {
+	if httpCtx.span == nil {
+		return
+	}
+	if httpCtx.Route != "" {
+		httpCtx.span.SetName(httpCtx.requestMethod + " /" + httpCtx.Route)
+		httpCtx.span.SetAttributes(attribute.String("http.route", "/"+httpCtx.Route))
+	}
+	//handler直接输出的时候HTTPStatus不准确
+	status := httpCtx.ResponseStatus()
+	httpCtx.span.SetAttributes(attribute.Int("http.status_code", status))
+	if status >= http.StatusInternalServerError {
+		httpCtx.span.SetStatus(codes.Error, httpCtx.ErrMsg)
+	}
+	httpCtx.span.End()
+}
+
 func NewHTTPContext() *HTTPContext {
 	signal.GetSignalContext().WgAdd()
 	httpCtx := &HTTPContext{}
@@ -152,16 +209,21 @@ func (httpCtx *HTTPContext) Value(key interface{}) interface{} {
 	return httpCtx.Ctx.Value(key)
 }
 func (httpCtx *HTTPContext) Cancel() {
-	if httpCtx.isCanceled {
+	//closeNotify可能同时调用
+	if !atomic.CompareAndSwapInt32(&httpCtx.isCanceled, 0, 1) {
 		return
 	}
-	httpCtx.isCanceled = true
 	signal.GetSignalContext().WgDone()
 	httpCtx.cancel()
 	//不能赋值nil，否则导致打印log报错
 	// httpCtx.Logger = nil
 }
 
+//Param 获取路由里:name参数段或*name通配段的值
+func (httpCtx *HTTPContext) Param(key string) string {
+	return httpCtx.params[key]
+}
+
 //GetForm 优先post和put,然后get
 func (httpCtx *HTTPContext) GetForm(key string) string {
 	return strings.TrimSpace(httpCtx.Request.FormValue(key))
@@ -210,9 +272,7 @@ func (httpCtx *HTTPContext) ThrowCheck(errNo int64, i interface{}) {
 		httpCtx.ErrMsg = errMsg
 	}
 
-	if httpCtx.ErrNo < Config.ErrorBase && Config.AppID > 0 {
-		httpCtx.ErrNo = Config.AppID*Config.ErrorBase + httpCtx.ErrNo
-	}
+	httpCtx.ErrNo = appErrNo(httpCtx.ErrNo)
 
 	httpCtx.StopRun()
 }
@@ -238,11 +298,17 @@ func (httpCtx *HTTPContext) CheckErr(errNo int64, i interface{}) (int64, string)
 		errMsg = httpCtx.ErrMsg
 	}
 
-	if errNo < Config.ErrorBase && Config.AppID > 0 {
-		errNo = Config.AppID*Config.ErrorBase + errNo
+	return appErrNo(errNo), errMsg
+}
+
+//appErrNo 小于ErrorBase的错误码加上AppID*ErrorBase
+func appErrNo(errNo int64) int64 {
+	c := configs.Get()
+	if errNo < c.ErrorBase && c.AppID > 0 {
+		return c.AppID*c.ErrorBase + errNo
 	}
 
-	return errNo, errMsg
+	return errNo
 }
 
 //SetDownloadMode ..
@@ -3,7 +3,6 @@ package hfw
 //手动匹配路由
 import (
 	"net/http"
-	"strings"
 
 	"github.com/gorilla/websocket"
 	"github.com/hsyan2008/hfw/configs"
@@ -31,37 +30,67 @@ var _ ControllerInterface = &Controller{}
 type Controller struct {
 }
 
+//不为nil的时候替代redis存储session
+var sessionStore session.Store
+
+//SetSessionStore 设置session的存储，如测试的时候使用session.NewSessMemoryStore()
+func SetSessionStore(store session.Store) {
+	sessionStore = store
+}
+
 //Init 请不要实现Init方法
+//只做内容协商等不耗资源的初始化，session在SessionMiddleware里创建，限流等拒绝的请求不需要创建
 func (ctl *Controller) Init(httpCtx *HTTPContext) {
 
 	var err error
 
 	// logger.Debug("Controller init")
 
-	if strings.Contains(httpCtx.Request.URL.RawQuery, "format=json") {
-		httpCtx.IsJSON = true
-	} else if strings.Contains(httpCtx.Request.Header.Get("Accept"), "application/json") {
+	httpCtx.MediaType = negotiateMediaType(httpCtx.Request.URL.Query().Get("format"),
+		httpCtx.Request.Header.Get("Accept"))
+	if httpCtx.MediaType == MIMEJSON {
 		httpCtx.IsJSON = true
 	}
 
-	if strings.Contains(httpCtx.Request.Header.Get("Accept-Encoding"), "gzip") {
-		httpCtx.IsZip = true
+	c := configs.Get()
+	httpCtx.Layout = templateConfig().Layout
+	httpCtx.IsETag = c.Server.IsETag
+
+	if !c.Server.Compress.IsDisable {
+		httpCtx.ContentEncoding = negotiateEncoding(httpCtx.Request.Header.Get("Accept-Encoding"))
+		httpCtx.IsZip = httpCtx.ContentEncoding != ""
 	}
 
 	// _ = httpCtx.Request.ParseMultipartForm(2 * 1024 * 1024)
 
-	//开启session，暂时只支持redis
-	if configs.Config.EnableSession || configs.Config.Session.IsEnable {
-		if redis.DefaultIns != nil {
-			store := session.NewSessRedisStore(redis.DefaultIns, configs.Config.Redis)
-			httpCtx.Session = session.NewSession(httpCtx.Request, store, configs.Config.Session)
-		} else {
-			httpCtx.Error("session enable faild: redis instance is nil")
-		}
-	}
 	httpCtx.ThrowCheck(500, err)
 }
 
+//SessionMiddleware 开启session的时候创建，在并发控制和限流之后，被拒绝的请求不访问存储
+func SessionMiddleware(next ContextHandler) ContextHandler {
+	return func(httpCtx *HTTPContext) {
+		httpCtx.initSession()
+		next(httpCtx)
+	}
+}
+
+//initSession 开启session的时候创建，默认使用redis，已经创建的不重复创建
+//没有可用的存储时Session为nil，开启Csrf的时候POST等请求会被拒绝
+func (httpCtx *HTTPContext) initSession() {
+	c := configs.Get()
+	if httpCtx.Session != nil || httpCtx.Request == nil || !(c.EnableSession || c.Session.IsEnable) {
+		return
+	}
+	if sessionStore != nil {
+		httpCtx.Session = session.NewSession(httpCtx.Request, sessionStore, c.Session)
+	} else if redis.DefaultIns.IsInit() {
+		store := session.NewSessRedisStore(redis.DefaultIns, c.Redis)
+		httpCtx.Session = session.NewSession(httpCtx.Request, store, c.Session)
+	} else {
+		httpCtx.Error("session enable faild: redis instance is nil")
+	}
+}
+
 //Before ..
 func (ctl *Controller) Before(httpCtx *HTTPContext) {
 	// logger.Debug("Controller Before")
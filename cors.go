@@ -0,0 +1,128 @@
+package hfw
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/hsyan2008/hfw/configs"
+)
+
+var defaultCorsMethods = []string{
+	http.MethodGet, http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete, http.MethodHead,
+}
+
+//handleCors 按Cors配置设置跨域的header，返回true表示是预检请求，已经输出
+//exists判断路由是否注册了预检请求的方法，不存在的时候不处理预检，按正常流程返回404
+func (httpCtx *HTTPContext) handleCors(exists func(method string) bool) bool {
+	conf := configs.Get().Cors
+	r := httpCtx.Request
+	origin := r.Header.Get("Origin")
+	if !conf.IsEnable || origin == "" {
+		return false
+	}
+
+	header := httpCtx.ResponseWriter.Header()
+	addVary(header, "Origin")
+
+	reqMethod := r.Header.Get("Access-Control-Request-Method")
+	isPreflight := r.Method == http.MethodOptions && reqMethod != ""
+	if isPreflight {
+		if !exists(reqMethod) {
+			return false
+		}
+		addVary(header, "Access-Control-Request-Method")
+		addVary(header, "Access-Control-Request-Headers")
+	}
+
+	if !isCorsOriginAllowed(conf.AllowOrigins, origin) {
+		if isPreflight {
+			httpCtx.ResponseWriter.WriteHeader(http.StatusForbidden)
+		}
+		return isPreflight
+	}
+
+	if isAllowAllOrigins(conf.AllowOrigins) && !conf.AllowCredentials {
+		header.Set("Access-Control-Allow-Origin", "*")
+	} else {
+		header.Set("Access-Control-Allow-Origin", origin)
+	}
+	if conf.AllowCredentials {
+		header.Set("Access-Control-Allow-Credentials", "true")
+	}
+
+	if !isPreflight {
+		if len(conf.ExposeHeaders) > 0 {
+			header.Set("Access-Control-Expose-Headers", strings.Join(conf.ExposeHeaders, ", "))
+		}
+		return false
+	}
+
+	methods := conf.AllowMethods
+	if len(methods) == 0 {
+		methods = defaultCorsMethods
+	}
+	if !containsFold(methods, reqMethod) {
+		header.Del("Access-Control-Allow-Origin")
+		header.Del("Access-Control-Allow-Credentials")
+		httpCtx.ResponseWriter.WriteHeader(http.StatusForbidden)
+		return true
+	}
+	header.Set("Access-Control-Allow-Methods", strings.Join(methods, ", "))
+
+	if len(conf.AllowHeaders) == 0 || containsFold(conf.AllowHeaders, "*") {
+		if reqHeaders := r.Header.Get("Access-Control-Request-Headers"); reqHeaders != "" {
+			header.Set("Access-Control-Allow-Headers", reqHeaders)
+		}
+	} else {
+		header.Set("Access-Control-Allow-Headers", strings.Join(conf.AllowHeaders, ", "))
+	}
+	if conf.MaxAge > 0 {
+		header.Set("Access-Control-Max-Age", strconv.Itoa(conf.MaxAge))
+	}
+	httpCtx.ResponseWriter.WriteHeader(http.StatusNoContent)
+
+	return true
+}
+
+func isAllowAllOrigins(origins []string) bool {
+	for _, v := range origins {
+		if v == "*" {
+			return true
+		}
+	}
+
+	return false
+}
+
+//isCorsOriginAllowed 支持一个*通配，如https://*.example.com
+func isCorsOriginAllowed(origins []string, origin string) bool {
+	origin = strings.ToLower(origin)
+	for _, v := range origins {
+		v = strings.ToLower(v)
+		if v == "*" || v == origin {
+			return true
+		}
+		i := strings.Index(v, "*")
+		if i < 0 {
+			continue
+		}
+		prefix, suffix := v[:i], v[i+1:]
+		if len(origin) > len(prefix)+len(suffix) &&
+			strings.HasPrefix(origin, prefix) && strings.HasSuffix(origin, suffix) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func containsFold(list []string, s string) bool {
+	for _, v := range list {
+		if strings.EqualFold(v, s) {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,62 @@
+package hfw
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/hsyan2008/hfw/configs"
+)
+
+func TestHandleCors(t *testing.T) {
+	c := *configs.Get()
+	defer configs.Set(configs.Set(&c))
+	c.Cors = configs.CorsConfig{
+		IsEnable:         true,
+		AllowOrigins:     []string{"https://*.example.com"},
+		AllowCredentials: true,
+		MaxAge:           600,
+	}
+
+	serve := func(method, origin, reqMethod string, exists bool) (*httptest.ResponseRecorder, bool) {
+		r := httptest.NewRequest(method, "/user", nil)
+		r.Header.Set("Origin", origin)
+		if reqMethod != "" {
+			r.Header.Set("Access-Control-Request-Method", reqMethod)
+			r.Header.Set("Access-Control-Request-Headers", "X-Token")
+		}
+		w := httptest.NewRecorder()
+		httpCtx := &HTTPContext{ResponseWriter: w, Request: r}
+		return w, httpCtx.handleCors(func(string) bool { return exists })
+	}
+
+	w, done := serve("OPTIONS", "https://api.example.com", "PUT", true)
+	if !done || w.Code != http.StatusNoContent {
+		t.Fatalf("preflight: %v %d", done, w.Code)
+	}
+	if w.Header().Get("Access-Control-Allow-Origin") != "https://api.example.com" ||
+		w.Header().Get("Access-Control-Allow-Credentials") != "true" ||
+		w.Header().Get("Access-Control-Allow-Headers") != "X-Token" ||
+		w.Header().Get("Access-Control-Max-Age") != "600" {
+		t.Errorf("preflight header: %v", w.Header())
+	}
+
+	if _, done = serve("OPTIONS", "https://api.example.com", "PUT", false); done {
+		t.Error("not exist route should not be handled")
+	}
+
+	w, done = serve("OPTIONS", "https://evil.com", "PUT", true)
+	if !done || w.Code != http.StatusForbidden || w.Header().Get("Access-Control-Allow-Origin") != "" {
+		t.Errorf("forbidden origin: %d %v", w.Code, w.Header())
+	}
+
+	w, done = serve("OPTIONS", "https://api.example.com", "TRACE", true)
+	if !done || w.Code != http.StatusForbidden {
+		t.Errorf("forbidden method: %d", w.Code)
+	}
+
+	w, done = serve("GET", "https://api.example.com", "", true)
+	if done || w.Header().Get("Access-Control-Allow-Origin") != "https://api.example.com" || w.Header().Get("Vary") != "Origin" {
+		t.Errorf("simple request: %v", w.Header())
+	}
+}
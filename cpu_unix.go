@@ -0,0 +1,19 @@
+//go:build !windows
+// +build !windows
+
+package hfw
+
+import (
+	"syscall"
+	"time"
+)
+
+//processCPUTime 进程使用的cpu时间(用户态+内核态)
+func processCPUTime() (time.Duration, bool) {
+	var ru syscall.Rusage
+	if err := syscall.Getrusage(syscall.RUSAGE_SELF, &ru); err != nil {
+		return 0, false
+	}
+
+	return time.Duration(ru.Utime.Nano() + ru.Stime.Nano()), true
+}
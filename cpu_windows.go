@@ -0,0 +1,11 @@
+//go:build windows
+// +build windows
+
+package hfw
+
+import "time"
+
+//processCPUTime windows下不支持，自适应限流不检查cpu
+func processCPUTime() (time.Duration, bool) {
+	return 0, false
+}
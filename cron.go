@@ -1,17 +1,29 @@
 package hfw
 
 import (
+	"context"
+	"reflect"
+	"runtime"
 	"time"
 
 	"github.com/hsyan2008/hfw/common"
+	"github.com/hsyan2008/hfw/signal"
 	cron "github.com/robfig/cron/v3"
 )
 
 var crontab *cron.Cron
 
+//WrapCron里的requestMethod，requestPath是cmd的函数名
+const cronMethod = "CRON"
+
 func init() {
 	crontab = cron.New(cron.WithSeconds())
 	crontab.Start()
+	//退出的时候不再调度新的任务，正在执行的WrapCron任务在等待Wg的阶段完成
+	signal.OnShutdown("cron", signal.PriorityStopAccept, func(context.Context) error {
+		crontab.Stop()
+		return nil
+	})
 }
 
 func AddCron(spec string, cmd func()) (cron.EntryID, error) {
@@ -32,14 +44,20 @@ func DoWrapCron(spec string, cmd func(httpCtx *HTTPContext) error) (cron.EntryID
 	return AddCron(spec, f)
 }
 
+//WrapCron cmd里的panic和返回的错误会调用OnError注册的ErrorHandler
 func WrapCron(cmd func(httpCtx *HTTPContext) error) func() {
+	name := runtime.FuncForPC(reflect.ValueOf(cmd).Pointer()).Name()
 	return func() {
 		httpCtx := NewHTTPContext()
 		defer httpCtx.Cancel()
+		httpCtx.requestMethod = cronMethod
+		httpCtx.requestPath = name
 		defer func(now time.Time) {
 			if err := recover(); err != nil {
 				if err != ErrStopRun {
-					httpCtx.Warn(err, string(common.GetStack()))
+					stack := common.GetStack()
+					httpCtx.Warn(err, string(stack))
+					httpCtx.reportError(err, stack)
 				}
 			}
 			httpCtx.Infof("CostTime: %s", time.Since(now))
@@ -48,6 +66,7 @@ func WrapCron(cmd func(httpCtx *HTTPContext) error) func() {
 		err := cmd(httpCtx)
 		if err != nil {
 			httpCtx.Warn(err)
+			httpCtx.reportError(err, nil)
 		}
 	}
 }
@@ -0,0 +1,124 @@
+package hfw
+
+import (
+	"fmt"
+	"html/template"
+	"net/http"
+
+	"github.com/hsyan2008/hfw/configs"
+)
+
+const (
+	defaultCSRFFieldName  = "_csrf"
+	defaultCSRFHeaderName = "X-CSRF-Token"
+)
+
+//代码里注册的不校验csrf的路由前缀
+var csrfExemptPaths []string
+
+func init() {
+	//模板里使用{{csrfField .}}输出隐藏域，或者{{csrfToken .}}给ajax使用
+	RegisterFuncMap(template.FuncMap{
+		"csrfToken": func(httpCtx *HTTPContext) string {
+			return httpCtx.CSRFToken()
+		},
+		"csrfField": func(httpCtx *HTTPContext) template.HTML {
+			return template.HTML(fmt.Sprintf(`<input type="hidden" name="%s" value="%s">`,
+				template.HTMLEscapeString(csrfFieldName()), template.HTMLEscapeString(httpCtx.CSRFToken())))
+		},
+	})
+}
+
+//CSRFExempt 添加不校验csrf的路由前缀，和Csrf.ExemptPaths一起生效
+func CSRFExempt(paths ...string) {
+	csrfExemptPaths = append(csrfExemptPaths, paths...)
+}
+
+//CSRFToken 当前session的csrf token，没有开启session的时候返回空
+func (httpCtx *HTTPContext) CSRFToken() string {
+	if httpCtx.Session == nil {
+		return ""
+	}
+	token, err := httpCtx.Session.CSRFToken()
+	if err != nil {
+		httpCtx.Warn("csrf token:", err)
+	}
+
+	return token
+}
+
+//CSRFMiddleware 开启Csrf后，校验POST、PUT、DELETE等请求的csrf token，失败返回403
+//token从Csrf.HeaderName或者表单的Csrf.FieldName获取，grpc请求不校验
+//没有session(未开启Session或者存储不可用)的时候无法校验，也返回403
+func CSRFMiddleware(next ContextHandler) ContextHandler {
+	return func(httpCtx *HTTPContext) {
+		if !configs.Get().Csrf.IsEnable || httpCtx.Request == nil ||
+			isSafeMethod(httpCtx.Request.Method) || isCSRFExempt(httpCtx.requestPath) {
+			next(httpCtx)
+			return
+		}
+
+		//HandlerFunc注册的路由没有经过Controller.Init
+		httpCtx.initSession()
+		if httpCtx.Session == nil {
+			httpCtx.Warn("csrf: session is nil")
+			csrfForbidden(httpCtx)
+			return
+		}
+
+		token := httpCtx.Request.Header.Get(csrfHeaderName())
+		if token == "" {
+			token = httpCtx.Request.FormValue(csrfFieldName())
+		}
+		if !httpCtx.Session.CheckCSRFToken(token) {
+			httpCtx.Warn("invalid csrf token")
+			csrfForbidden(httpCtx)
+			return
+		}
+
+		next(httpCtx)
+	}
+}
+
+func csrfForbidden(httpCtx *HTTPContext) {
+	httpCtx.HTTPStatus = http.StatusForbidden
+	httpCtx.IsError = true
+	httpCtx.ErrNo = http.StatusForbidden
+	httpCtx.ErrMsg = "invalid csrf token"
+}
+
+func isSafeMethod(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace:
+		return true
+	}
+
+	return false
+}
+
+func isCSRFExempt(path string) bool {
+	segments := splitPath(path)
+	for _, list := range [][]string{configs.Get().Csrf.ExemptPaths, csrfExemptPaths} {
+		for _, v := range list {
+			if hasPathPrefix(segments, splitPath(v)) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+func csrfFieldName() string {
+	if name := configs.Get().Csrf.FieldName; name != "" {
+		return name
+	}
+	return defaultCSRFFieldName
+}
+
+func csrfHeaderName() string {
+	if name := configs.Get().Csrf.HeaderName; name != "" {
+		return name
+	}
+	return defaultCSRFHeaderName
+}
@@ -0,0 +1,138 @@
+package hfw
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/hsyan2008/hfw/configs"
+	"github.com/hsyan2008/hfw/session"
+)
+
+type memSessionStore map[string]interface{}
+
+func (m memSessionStore) SetExpiration(int64) {}
+func (m memSessionStore) Put(id, key string, value interface{}) error {
+	m[id+key] = value
+	return nil
+}
+func (m memSessionStore) Get(value interface{}, id, key string) error {
+	if v, ok := m[id+key]; ok {
+		*value.(*string) = v.(string)
+	}
+	return nil
+}
+func (m memSessionStore) IsExist(id, key string) (bool, error) {
+	_, ok := m[id+key]
+	return ok, nil
+}
+func (m memSessionStore) Del(id, key string) error {
+	delete(m, id+key)
+	return nil
+}
+func (m memSessionStore) Destroy(string) error        { return nil }
+func (m memSessionStore) Rename(string, string) error { return nil }
+
+func TestCSRFMiddleware(t *testing.T) {
+	c := *configs.Get()
+	defer configs.Set(configs.Set(&c))
+	c.Csrf = configs.CsrfConfig{IsEnable: true, ExemptPaths: []string{"/callback"}}
+
+	store := memSessionStore{}
+	cookie := &http.Cookie{Name: "sess_name", Value: "sid"}
+	r := httptest.NewRequest("GET", "/form", nil)
+	r.AddCookie(cookie)
+	token := (&HTTPContext{Session: session.NewSession(r, store, configs.SessionConfig{})}).CSRFToken()
+	if token == "" {
+		t.Fatal("nil token")
+	}
+
+	serve := func(method, path, header, field string) (*HTTPContext, bool) {
+		form := url.Values{}
+		if field != "" {
+			form.Set(defaultCSRFFieldName, field)
+		}
+		r := httptest.NewRequest(method, path, strings.NewReader(form.Encode()))
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		r.AddCookie(cookie)
+		if header != "" {
+			r.Header.Set(defaultCSRFHeaderName, header)
+		}
+		httpCtx := NewHTTPContext()
+		httpCtx.Request, httpCtx.HTTPStatus = r, http.StatusOK
+		httpCtx.requestPath, httpCtx.requestMethod = path, method
+		httpCtx.Session = session.NewSession(r, store, configs.SessionConfig{})
+		return httpCtx, runMiddlewares(httpCtx, []Middleware{CSRFMiddleware}, func(*HTTPContext) {})
+	}
+
+	if _, done := serve("GET", "/form", "", ""); !done {
+		t.Error("GET should pass")
+	}
+	if httpCtx, done := serve("POST", "/form", "", ""); done || httpCtx.HTTPStatus != http.StatusForbidden {
+		t.Errorf("expect 403, got %d", httpCtx.HTTPStatus)
+	}
+	if _, done := serve("POST", "/form", "", "wrong"); done {
+		t.Error("wrong token should fail")
+	}
+	if _, done := serve("POST", "/form", "", token); !done {
+		t.Error("form token should pass")
+	}
+	if _, done := serve("DELETE", "/form", token, ""); !done {
+		t.Error("header token should pass")
+	}
+	if _, done := serve("POST", "/callback/pay", "", ""); !done {
+		t.Error("exempt path should pass")
+	}
+}
+
+func TestCSRFHandlerFunc(t *testing.T) {
+	c := *configs.Get()
+	defer configs.Set(configs.Set(&c))
+	c.Session.IsEnable = true
+	c.Csrf = configs.CsrfConfig{IsEnable: true}
+
+	var called int
+	HandlerFunc("/csrf/handler_func", func(w http.ResponseWriter, r *http.Request) {
+		called++
+		_, _ = w.Write([]byte("ok"))
+	})
+	serve := func(method, token string, cookie *http.Cookie) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(method, "/csrf/handler_func", nil)
+		if cookie != nil {
+			r.AddCookie(cookie)
+		}
+		if token != "" {
+			r.Header.Set(defaultCSRFHeaderName, token)
+		}
+		w := httptest.NewRecorder()
+		http.DefaultServeMux.ServeHTTP(w, r)
+		return w
+	}
+
+	//存储不可用的时候不能放行
+	if w := serve("POST", "", nil); w.Code != http.StatusForbidden || called != 0 {
+		t.Errorf("no store: %d %d", w.Code, called)
+	}
+
+	store := memSessionStore{}
+	SetSessionStore(store)
+	defer SetSessionStore(nil)
+
+	w := serve("GET", "", nil)
+	cookies := w.Result().Cookies()
+	if w.Code != http.StatusOK || called != 1 || len(cookies) != 1 || cookies[0].Name != "sess_name" {
+		t.Fatalf("GET: %d %d %v", w.Code, called, cookies)
+	}
+	if w := serve("POST", "", cookies[0]); w.Code != http.StatusForbidden || called != 1 {
+		t.Errorf("no token: %d %d", w.Code, called)
+	}
+
+	r := httptest.NewRequest("GET", "/", nil)
+	r.AddCookie(cookies[0])
+	token := (&HTTPContext{Session: session.NewSession(r, store, configs.SessionConfig{})}).CSRFToken()
+	if w := serve("POST", token, cookies[0]); w.Code != http.StatusOK || called != 2 {
+		t.Errorf("token: %d %d", w.Code, called)
+	}
+}
@@ -18,6 +18,10 @@ import (
 	"strings"
 	"sync"
 	"time"
+
+	"github.com/hsyan2008/hfw/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
 type Response struct {
@@ -204,6 +208,12 @@ func (curls *Curl) Request() (rs *Response, err error) {
 	if curls.timeout <= 0 {
 		curls.SetTimeout(5)
 	}
+	//不超过ctx的deadline，如请求设置的超时
+	if deadline, ok := curls.ctx.Deadline(); ok {
+		if d := time.Until(deadline); d < curls.timeout {
+			curls.timeout = d
+		}
+	}
 
 	rs = &Response{
 		// cancel: curls.cancel,
@@ -214,7 +224,21 @@ func (curls *Curl) Request() (rs *Response, err error) {
 		return
 	}
 
-	httpRequest = httpRequest.WithContext(curls.ctx)
+	ctx, span := tracing.Start(curls.ctx, "HTTP "+httpRequest.Method, trace.SpanKindClient,
+		attribute.String("http.method", httpRequest.Method),
+		attribute.String("http.url", httpRequest.URL.Redacted()),
+	)
+	defer func() {
+		if rs != nil && rs.Response != nil {
+			span.SetAttributes(attribute.Int("http.status_code", rs.StatusCode))
+		}
+		tracing.End(span, err)
+	}()
+	//Header是curls.Headers，复制后再写入traceparent，避免修改调用方的map
+	httpRequest.Header = httpRequest.Header.Clone()
+	tracing.InjectHTTP(ctx, httpRequest.Header)
+
+	httpRequest = httpRequest.WithContext(ctx)
 
 	httpClient, err := curls.getHttpClient()
 	if err != nil {
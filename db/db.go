@@ -1,6 +1,7 @@
 package db
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"strings"
@@ -20,6 +21,23 @@ import (
 
 var engineMap = new(sync.Map)
 
+func init() {
+	signal.OnShutdown("db", signal.PriorityClosePool, closeEngines)
+}
+
+//closeEngines 退出的时候关闭所有的连接池
+func closeEngines(context.Context) (err error) {
+	engineMap.Range(func(key, value interface{}) bool {
+		if e := value.(*xorm.Engine).Close(); e != nil {
+			err = e
+		}
+		engineMap.Delete(key)
+		return true
+	})
+
+	return
+}
+
 func InitDb(config configs.AllConfig, dbConfig configs.DbConfig) (engine xorm.EngineInterface, err error) {
 
 	var isNew bool
@@ -96,6 +114,7 @@ func getEngine(config configs.DbStdConfig) (engine *xorm.Engine, isNew bool, err
 		return engine, isNew, fmt.Errorf("NewEngine dbConfig: %v failed: %v", config, err)
 	}
 
+	engine.AddHook(traceHook{system: driver})
 	engineMap.Store(common.Md5(dbDsn), engine)
 	isNew = true
 
@@ -0,0 +1,35 @@
+package db
+
+import (
+	"context"
+	"strings"
+
+	"github.com/hsyan2008/hfw/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"xorm.io/xorm/contexts"
+)
+
+//traceHook 给sql创建span，只有通过WithContext传入了带span的ctx才记录
+type traceHook struct {
+	system string
+}
+
+var _ contexts.Hook = traceHook{}
+
+func (h traceHook) BeforeProcess(c *contexts.ContextHook) (context.Context, error) {
+	operation := strings.ToUpper(strings.SplitN(strings.TrimSpace(c.SQL), " ", 2)[0])
+	ctx, _ := tracing.StartChild(c.Ctx, "db "+operation, trace.SpanKindClient,
+		attribute.String("db.system", h.system),
+		attribute.String("db.operation", operation),
+		attribute.String("db.statement", c.SQL),
+	)
+
+	return ctx, nil
+}
+
+func (h traceHook) AfterProcess(c *contexts.ContextHook) error {
+	tracing.End(trace.SpanFromContext(c.Ctx), c.Err)
+
+	return nil
+}
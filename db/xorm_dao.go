@@ -1,6 +1,7 @@
 package db
 
 import (
+	"context"
 	"database/sql"
 	"errors"
 	"fmt"
@@ -47,6 +48,48 @@ type XormDao struct {
 	isCache bool
 	cacher  *caches.LRUCacher
 	sess    *xorm.Session
+	//用于链路追踪和超时
+	ctx context.Context
+}
+
+//WithContext 返回使用ctx执行sql的XormDao，如dao.WithContext(httpCtx).SearchOne(...)
+//Notice: 已经NewSession的事务会共享同一个session
+func (d *XormDao) WithContext(ctx context.Context) *XormDao {
+	dao := *d
+	dao.ctx = ctx
+	if dao.sess != nil {
+		dao.sess = dao.sess.Context(ctx)
+	}
+
+	return &dao
+}
+
+func (d *XormDao) newSession() *xorm.Session {
+	sess := d.engine.NewSession()
+	if d.ctx != nil {
+		sess = sess.Context(d.ctx)
+	}
+
+	return sess
+}
+
+//PingMaster 检查主库的连接，用于健康检查
+func (d *XormDao) PingMaster(ctx context.Context) error {
+	if eg, ok := d.engine.(*xorm.EngineGroup); ok {
+		return eg.Master().PingContext(ctx)
+	}
+
+	return d.engine.(*xorm.Engine).PingContext(ctx)
+}
+
+//PingSlave 检查第i个从库的连接，i和DbConfig.Slaves的顺序一致
+func (d *XormDao) PingSlave(ctx context.Context, i int) error {
+	eg, ok := d.engine.(*xorm.EngineGroup)
+	if !ok || i < 0 || i >= len(eg.Slaves()) {
+		return fmt.Errorf("slave %d not exist", i)
+	}
+
+	return eg.Slaves()[i].PingContext(ctx)
 }
 
 func (d *XormDao) GetConf() configs.DbConfig {
@@ -67,7 +110,7 @@ func (d *XormDao) UpdateByIds(t Model, params interface{},
 
 	sess := d.sess
 	if sess == nil {
-		sess = d.engine.NewSession()
+		sess = d.newSession()
 		defer sess.Close()
 	}
 	if len(cols) > 0 {
@@ -94,7 +137,7 @@ func (d *XormDao) UpdateByWhere(t Model, params Cond,
 
 	sess := d.sess
 	if sess == nil {
-		sess = d.engine.NewSession()
+		sess = d.newSession()
 		defer sess.Close()
 	}
 	sess, err = d.buildCond(t, sess, where, false, false)
@@ -113,7 +156,7 @@ func (d *XormDao) UpdateByWhere(t Model, params Cond,
 func (d *XormDao) Insert(m, t Model) (affected int64, err error) {
 	sess := d.sess
 	if sess == nil {
-		sess = d.engine.NewSession()
+		sess = d.newSession()
 		defer sess.Close()
 	}
 
@@ -128,7 +171,7 @@ func (d *XormDao) Insert(m, t Model) (affected int64, err error) {
 func (d *XormDao) InsertMulti(m Model, t interface{}) (affected int64, err error) {
 	sess := d.sess
 	if sess == nil {
-		sess = d.engine.NewSession()
+		sess = d.newSession()
 		defer sess.Close()
 	}
 
@@ -143,7 +186,7 @@ func (d *XormDao) InsertMulti(m Model, t interface{}) (affected int64, err error
 func (d *XormDao) SearchOne(t Model, cond Cond) (has bool, err error) {
 	sess := d.sess
 	if sess == nil {
-		sess = d.engine.NewSession()
+		sess = d.newSession()
 		defer sess.Close()
 	}
 	sess, err = d.buildCond(t, sess, cond, true, false)
@@ -327,7 +370,7 @@ FOR:
 func (d *XormDao) Search(t Model, ts interface{}, cond Cond) (err error) {
 	sess := d.sess
 	if sess == nil {
-		sess = d.engine.NewSession()
+		sess = d.newSession()
 		defer sess.Close()
 	}
 	sess, err = d.buildCond(t, sess, cond, true, true)
@@ -347,7 +390,7 @@ func (d *XormDao) Search(t Model, ts interface{}, cond Cond) (err error) {
 func (d *XormDao) SearchAndCount(t Model, ts interface{}, cond Cond) (total int64, err error) {
 	sess := d.sess
 	if sess == nil {
-		sess = d.engine.NewSession()
+		sess = d.newSession()
 		defer sess.Close()
 	}
 	sess, err = d.buildCond(t, sess, cond, true, true)
@@ -367,7 +410,7 @@ func (d *XormDao) SearchAndCount(t Model, ts interface{}, cond Cond) (total int6
 func (d *XormDao) Rows(t Model, cond Cond) (rows *xorm.Rows, err error) {
 	sess := d.sess
 	if sess == nil {
-		sess = d.engine.NewSession()
+		sess = d.newSession()
 		defer sess.Close()
 	}
 	sess, err = d.buildCond(t, sess, cond, true, true)
@@ -387,7 +430,7 @@ func (d *XormDao) Rows(t Model, cond Cond) (rows *xorm.Rows, err error) {
 func (d *XormDao) Iterate(t Model, cond Cond, f xorm.IterFunc) (err error) {
 	sess := d.sess
 	if sess == nil {
-		sess = d.engine.NewSession()
+		sess = d.newSession()
 		defer sess.Close()
 	}
 	sess, err = d.buildCond(t, sess, cond, true, true)
@@ -407,7 +450,7 @@ func (d *XormDao) Iterate(t Model, cond Cond, f xorm.IterFunc) (err error) {
 func (d *XormDao) GetByIds(t Model, ts interface{}, ids []interface{}, cols ...string) (err error) {
 	sess := d.sess
 	if sess == nil {
-		sess = d.engine.NewSession()
+		sess = d.newSession()
 		defer sess.Close()
 	}
 	if len(cols) > 0 {
@@ -426,7 +469,7 @@ func (d *XormDao) GetByIds(t Model, ts interface{}, ids []interface{}, cols ...s
 func (d *XormDao) Count(t Model, cond Cond) (total int64, err error) {
 	sess := d.sess
 	if sess == nil {
-		sess = d.engine.NewSession()
+		sess = d.newSession()
 		defer sess.Close()
 	}
 	sess, err = d.buildCond(t, sess, cond, false, false)
@@ -472,7 +515,7 @@ func (d *XormDao) Exec(sqlStr string, args ...interface{}) (rs sql.Result, err e
 
 	sess := d.sess
 	if sess == nil {
-		sess = d.engine.NewSession()
+		sess = d.newSession()
 		defer sess.Close()
 	}
 	rs, err = sess.Exec(tmp...)
@@ -487,7 +530,7 @@ func (d *XormDao) Exec(sqlStr string, args ...interface{}) (rs sql.Result, err e
 func (d *XormDao) Query(t Model, args ...interface{}) (rs []map[string][]byte, err error) {
 	sess := d.sess
 	if sess == nil {
-		sess = d.engine.NewSession()
+		sess = d.newSession()
 		defer sess.Close()
 	}
 	if len(args) > 0 {
@@ -513,7 +556,7 @@ func (d *XormDao) Query(t Model, args ...interface{}) (rs []map[string][]byte, e
 func (d *XormDao) QueryString(t Model, args ...interface{}) (rs []map[string]string, err error) {
 	sess := d.sess
 	if sess == nil {
-		sess = d.engine.NewSession()
+		sess = d.newSession()
 		defer sess.Close()
 	}
 	if len(args) > 0 {
@@ -539,7 +582,7 @@ func (d *XormDao) QueryString(t Model, args ...interface{}) (rs []map[string]str
 func (d *XormDao) QueryInterface(t Model, args ...interface{}) (rs []map[string]interface{}, err error) {
 	sess := d.sess
 	if sess == nil {
-		sess = d.engine.NewSession()
+		sess = d.newSession()
 		defer sess.Close()
 	}
 	if len(args) > 0 {
@@ -570,7 +613,7 @@ func (d *XormDao) DeleteByIds(t Model, ids interface{}) (affected int64, err err
 
 	sess := d.sess
 	if sess == nil {
-		sess = d.engine.NewSession()
+		sess = d.newSession()
 		defer sess.Close()
 	}
 
@@ -590,7 +633,7 @@ func (d *XormDao) DeleteByWhere(t Model, where Cond) (affected int64, err error)
 
 	sess := d.sess
 	if sess == nil {
-		sess = d.engine.NewSession()
+		sess = d.newSession()
 		defer sess.Close()
 	}
 	sess, err = d.buildCond(t, sess, where, false, false)
@@ -632,7 +675,7 @@ func (d *XormDao) ClearCache(t Model) {
 //Notice: 注意并发不安全，请勿在全局上使用
 func (d *XormDao) NewSession() {
 	if d.sess == nil {
-		d.sess = d.engine.NewSession()
+		d.sess = d.newSession()
 	}
 }
 
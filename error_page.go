@@ -0,0 +1,79 @@
+package hfw
+
+import (
+	"fmt"
+	"html"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+//renderErrorPage 浏览器访问出错的时候，输出Template.ErrorPages里状态码对应的模板
+//开发环境下panic的时候输出错误和堆栈，返回false表示按原来的方式输出
+func (httpCtx *HTTPContext) renderErrorPage() bool {
+	if httpCtx.HTTPStatus < http.StatusBadRequest || httpCtx.IsJSON || httpCtx.MediaType != "" ||
+		httpCtx.Request == nil || !wantsHTML(httpCtx.Request) {
+		return false
+	}
+
+	if httpCtx.panicValue != nil && isDevMode() {
+		httpCtx.renderPanicPage()
+		return true
+	}
+
+	c := templateConfig()
+	file := c.ErrorPages[strconv.Itoa(httpCtx.HTTPStatus)]
+	if file == "" {
+		file = c.ErrorPage
+	}
+	if file == "" {
+		return false
+	}
+	httpCtx.Template = ""
+	httpCtx.TemplateFile = file
+	httpCtx.Render()
+
+	return true
+}
+
+func (httpCtx *HTTPContext) renderPanicPage() {
+	header := httpCtx.ResponseWriter.Header()
+	header.Set("Content-Type", "text/html; charset=utf-8")
+	header.Del("Content-Length")
+	httpCtx.ResponseWriter.WriteHeader(httpCtx.HTTPStatus)
+	_, _ = fmt.Fprintf(httpCtx.ResponseWriter, panicErrorPage,
+		httpCtx.HTTPStatus, html.EscapeString(httpCtx.ErrMsg),
+		html.EscapeString(httpCtx.Request.Method+" "+httpCtx.Request.URL.RequestURI()),
+		html.EscapeString(httpCtx.GetTraceID()),
+		html.EscapeString(fmt.Sprint(httpCtx.panicValue)), html.EscapeString(string(httpCtx.panicStack)))
+}
+
+const panicErrorPage = `<!DOCTYPE html>
+<html><head><meta charset="utf-8"><title>%d %s</title></head>
+<body style="font-family:monospace">
+<h2>Panic</h2>
+<p>%s</p>
+<p>Trace-Id: %s</p>
+<pre style="background:#fee;padding:10px;white-space:pre-wrap">%s</pre>
+<pre style="background:#eee;padding:10px;white-space:pre-wrap">%s</pre>
+</body></html>`
+
+//wantsHTML 客户端明确接受text/html，并且不是ajax请求
+func wantsHTML(r *http.Request) bool {
+	if r.Header.Get("X-Requested-With") == "XMLHttpRequest" {
+		return false
+	}
+	for _, item := range strings.Split(r.Header.Get("Accept"), ",") {
+		t, params, err := mime.ParseMediaType(strings.TrimSpace(item))
+		if err != nil || t != MIMEHTML {
+			continue
+		}
+		if q, err := strconv.ParseFloat(params["q"], 64); err == nil && q == 0 {
+			continue
+		}
+		return true
+	}
+
+	return false
+}
@@ -0,0 +1,70 @@
+package hfw
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/hsyan2008/hfw/common"
+	"github.com/hsyan2008/hfw/configs"
+)
+
+func TestRenderErrorPage(t *testing.T) {
+	dir := t.TempDir()
+	err := os.WriteFile(filepath.Join(dir, "404.html"), []byte(`<h1>{{.HTTPStatus}} {{.ErrMsg}}</h1>`), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	setTemplateConfig(t, configs.TemplateConfig{HTMLPath: dir, ErrorPages: map[string]string{"404": "404.html"}})
+
+	serve := func(accept string, f func(httpCtx *HTTPContext)) *httptest.ResponseRecorder {
+		r := httptest.NewRequest("GET", "/missing", nil)
+		r.Header.Set("Accept", accept)
+		w := httptest.NewRecorder()
+		httpCtx := NewHTTPContext()
+		defer httpCtx.Cancel()
+		httpCtx.ResponseWriter, httpCtx.Request = w, r
+		f(httpCtx)
+		httpCtx.RenderResponse()
+		return w
+	}
+	notFound := func(httpCtx *HTTPContext) {
+		(&Controller{}).NotFound(httpCtx)
+	}
+
+	w := serve("text/html,application/xhtml+xml,*/*;q=0.8", notFound)
+	if w.Code != http.StatusNotFound || w.Body.String() != "<h1>404 NotFound</h1>" {
+		t.Errorf("html: %d %s", w.Code, w.Body.String())
+	}
+
+	w = serve("*/*", notFound)
+	if !strings.Contains(w.Body.String(), `"err_no":404`) {
+		t.Errorf("json: %s", w.Body.String())
+	}
+
+	//没有配置500的模板
+	w = serve("text/html", func(httpCtx *HTTPContext) {
+		(&Controller{}).ServerError(httpCtx)
+	})
+	if !strings.Contains(w.Body.String(), `"err_no":500`) {
+		t.Errorf("fallback: %s", w.Body.String())
+	}
+
+	oldEnv := common.ENVIRONMENT
+	defer func() {
+		common.ENVIRONMENT = oldEnv
+	}()
+	common.ENVIRONMENT = common.DEV
+	w = serve("text/html", func(httpCtx *HTTPContext) {
+		defer recoverPanic(httpCtx)
+		panic(errors.New("<boom>"))
+	})
+	if w.Code != http.StatusInternalServerError || !strings.Contains(w.Body.String(), "&lt;boom&gt;") ||
+		!strings.Contains(w.Body.String(), "error_page_test.go") {
+		t.Errorf("panic page: %d %s", w.Code, w.Body.String())
+	}
+}
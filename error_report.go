@@ -0,0 +1,277 @@
+package hfw
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	logger "github.com/hsyan2008/go-logger"
+	"github.com/hsyan2008/hfw/common"
+	"github.com/hsyan2008/hfw/configs"
+	"github.com/hsyan2008/hfw/curl"
+	"github.com/hsyan2008/hfw/encoding"
+	"github.com/hsyan2008/hfw/signal"
+	"google.golang.org/grpc/status"
+)
+
+//ErrorHandler 处理panic和5xx，err是panic的值或者error，stack只有panic的时候才有
+type ErrorHandler func(httpCtx *HTTPContext, err interface{}, stack []byte)
+
+var errorHandlers []ErrorHandler
+
+//OnError 注册错误处理，http、grpc和WrapCron里的panic和5xx都会调用
+//需要在启动服务之前注册
+func OnError(f ErrorHandler) {
+	errorHandlers = append(errorHandlers, f)
+}
+
+//reportError 依次调用注册的ErrorHandler，ErrorHandler里的panic不影响请求
+func (httpCtx *HTTPContext) reportError(err interface{}, stack []byte) {
+	for _, f := range errorHandlers {
+		func() {
+			defer func() {
+				if e := recover(); e != nil {
+					httpCtx.Warn("error handler panic:", e)
+				}
+			}()
+			f(httpCtx, err, stack)
+		}()
+	}
+}
+
+//reportHTTPError http请求结束的时候调用，panic或者状态码是5xx
+func (httpCtx *HTTPContext) reportHTTPError(status int) {
+	if len(errorHandlers) == 0 {
+		return
+	}
+	if httpCtx.panicValue != nil {
+		httpCtx.reportError(httpCtx.panicValue, httpCtx.panicStack)
+	} else if status >= http.StatusInternalServerError {
+		msg := httpCtx.ErrMsg
+		if msg == "" {
+			msg = http.StatusText(status)
+		}
+		httpCtx.reportError(errors.New(msg), nil)
+	}
+}
+
+//ErrorReport 内置上报使用的错误信息
+//Kind是http、grpc或者cron，Count是webhook合并的次数
+type ErrorReport struct {
+	Time       time.Time `json:"time"`
+	App        string    `json:"app"`
+	Host       string    `json:"host"`
+	Env        string    `json:"env"`
+	TraceID    string    `json:"trace_id"`
+	Kind       string    `json:"kind"`
+	Method     string    `json:"method"`
+	Path       string    `json:"path"`
+	Route      string    `json:"route,omitempty"`
+	Controller string    `json:"controller,omitempty"`
+	Action     string    `json:"action,omitempty"`
+	Status     int       `json:"status,omitempty"`
+	Error      string    `json:"error"`
+	Stack      string    `json:"stack,omitempty"`
+	ClientIP   string    `json:"client_ip,omitempty"`
+	UserAgent  string    `json:"user_agent,omitempty"`
+	Count      int       `json:"count"`
+}
+
+//NewErrorReport 从httpCtx获取请求的信息，自定义的ErrorHandler也可以使用
+func NewErrorReport(httpCtx *HTTPContext, err interface{}, stack []byte) *ErrorReport {
+	report := &ErrorReport{
+		Time:       time.Now(),
+		App:        common.GetAppName(),
+		Host:       common.GetHostName(),
+		Env:        common.GetEnv(),
+		TraceID:    httpCtx.GetTraceID(),
+		Method:     httpCtx.requestMethod,
+		Path:       httpCtx.requestPath,
+		Route:      httpCtx.Route,
+		Controller: httpCtx.Controller,
+		Action:     httpCtx.Action,
+		Error:      fmt.Sprint(err),
+		Stack:      string(stack),
+		ClientIP:   clientIP(httpCtx),
+		Count:      1,
+	}
+	switch {
+	case httpCtx.Request != nil:
+		report.Kind = "http"
+		report.Status = httpCtx.ResponseStatus()
+		report.Path = httpCtx.Request.URL.RequestURI()
+		report.UserAgent = httpCtx.Request.UserAgent()
+	case httpCtx.requestMethod == cronMethod:
+		report.Kind = "cron"
+	default:
+		report.Kind = "grpc"
+		report.Status = http.StatusInternalServerError
+		if e, ok := err.(error); ok {
+			report.Status = grpcHTTPStatus(status.Code(e))
+		}
+	}
+
+	return report
+}
+
+//initErrorReport 按ErrorReport的配置注册内置的上报
+func initErrorReport(c configs.ErrorReportConfig) (err error) {
+	if c.FilePath != "" {
+		r, err := newFileReporter(c.FilePath)
+		if err != nil {
+			return err
+		}
+		OnError(r.report)
+	}
+	if c.WebhookURL != "" {
+		interval := c.WebhookInterval
+		if interval <= 0 {
+			interval = time.Minute
+		}
+		r := newWebhookReporter(c.WebhookURL)
+		OnError(r.report)
+
+		signalContext := signal.GetSignalContext()
+		signalContext.WgAdd()
+		go func() {
+			defer signalContext.WgDone()
+			r.run(signalContext.Ctx, interval)
+		}()
+	}
+
+	return
+}
+
+//fileReporter 每个错误一行json
+type fileReporter struct {
+	mu   sync.Mutex
+	file *os.File
+}
+
+func newFileReporter(path string) (r *fileReporter, err error) {
+	err = os.MkdirAll(filepath.Dir(path), 0755)
+	if err != nil {
+		return
+	}
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return
+	}
+
+	return &fileReporter{file: f}, nil
+}
+
+func (r *fileReporter) report(httpCtx *HTTPContext, err interface{}, stack []byte) {
+	line, e := encoding.JSON.Marshal(NewErrorReport(httpCtx, err, stack))
+	if e != nil {
+		return
+	}
+	line = append(line, '\n')
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	_, _ = r.file.Write(line)
+}
+
+//一个间隔里最多合并的不同错误，超过的丢弃
+const maxWebhookPending = 100
+
+//webhookReporter 按间隔把相同的错误合并后POST到webhook，避免错误集中爆发的时候刷屏
+//相同指的是Kind、Method、路由和错误信息都一样，保留第一次的trace_id和堆栈
+type webhookReporter struct {
+	url string
+
+	mu      sync.Mutex
+	pending map[string]*ErrorReport
+	keys    []string
+	dropped int
+}
+
+func newWebhookReporter(url string) *webhookReporter {
+	return &webhookReporter{
+		url:     url,
+		pending: make(map[string]*ErrorReport),
+	}
+}
+
+func (r *webhookReporter) report(httpCtx *HTTPContext, err interface{}, stack []byte) {
+	report := NewErrorReport(httpCtx, err, stack)
+	path := report.Route
+	if path == "" {
+		path = httpCtx.requestPath
+	}
+	key := report.Kind + " " + report.Method + " " + path + " " + report.Error
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if p, ok := r.pending[key]; ok {
+		p.Count++
+		return
+	}
+	if len(r.keys) >= maxWebhookPending {
+		r.dropped++
+		return
+	}
+	r.pending[key] = report
+	r.keys = append(r.keys, key)
+}
+
+//run 每个间隔上报一次，ctx结束的时候上报剩余的
+func (r *webhookReporter) run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			r.flush()
+		case <-ctx.Done():
+			r.flush()
+			return
+		}
+	}
+}
+
+func (r *webhookReporter) flush() {
+	r.mu.Lock()
+	reports := make([]*ErrorReport, len(r.keys))
+	for i, key := range r.keys {
+		reports[i] = r.pending[key]
+	}
+	dropped := r.dropped
+	r.pending = make(map[string]*ErrorReport)
+	r.keys = nil
+	r.dropped = 0
+	r.mu.Unlock()
+
+	if dropped > 0 {
+		logger.Warnf("error report dropped %d errors", dropped)
+	}
+	if len(reports) == 0 {
+		return
+	}
+
+	body, err := encoding.JSON.Marshal(reports)
+	if err != nil {
+		logger.Warn("error report marshal:", err)
+		return
+	}
+	//退出的时候signal的ctx已经结束，所以不用它
+	c := curl.NewPost(context.Background(), r.url)
+	c.Headers.Set("Content-Type", "application/json")
+	c.SetPostBytes(body)
+	c.SetTimeout(5)
+	rs, err := c.Request()
+	if err != nil {
+		logger.Warn("error report post:", err)
+		return
+	}
+	defer rs.Close()
+	if rs.StatusCode >= http.StatusMultipleChoices {
+		logger.Warn("error report post:", rs.Status)
+	}
+}
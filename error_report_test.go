@@ -0,0 +1,112 @@
+package hfw
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hsyan2008/hfw/encoding"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestOnError(t *testing.T) {
+	old := errorHandlers
+	defer func() {
+		errorHandlers = old
+	}()
+	errorHandlers = nil
+
+	var reports []*ErrorReport
+	OnError(func(httpCtx *HTTPContext, err interface{}, stack []byte) {
+		reports = append(reports, NewErrorReport(httpCtx, err, stack))
+	})
+	OnError(func(*HTTPContext, interface{}, []byte) {
+		panic("ignored")
+	})
+
+	serve := func(f func(httpCtx *HTTPContext)) {
+		httpCtx := initCtx(httptest.NewRecorder(), httptest.NewRequest("GET", "/user/1?a=b", nil))
+		defer httpCtx.Cancel()
+		defer httpCtx.endRequest(time.Now())
+		defer recoverPanic(httpCtx)
+		f(httpCtx)
+	}
+	serve(func(httpCtx *HTTPContext) {
+		panic("boom")
+	})
+	serve(func(httpCtx *HTTPContext) {
+		httpCtx.HTTPStatus, httpCtx.ErrMsg = http.StatusBadGateway, "upstream"
+	})
+	serve(func(httpCtx *HTTPContext) {
+		httpCtx.HTTPStatus, httpCtx.ErrMsg = http.StatusBadRequest, "ignored"
+	})
+
+	info := &grpc.UnaryServerInfo{FullMethod: "/test.Service/Call"}
+	_, _ = UnaryServerInterceptor(context.Background(), nil, info, func(context.Context, interface{}) (interface{}, error) {
+		return nil, status.Error(codes.Unavailable, "down")
+	})
+	_, _ = UnaryServerInterceptor(context.Background(), nil, info, func(context.Context, interface{}) (interface{}, error) {
+		return nil, status.Error(codes.NotFound, "ignored")
+	})
+
+	WrapCron(func(httpCtx *HTTPContext) error {
+		panic("cron")
+	})()
+
+	if len(reports) != 4 {
+		t.Fatalf("reports: %d", len(reports))
+	}
+	if r := reports[0]; r.Kind != "http" || r.Error != "boom" || r.Status != http.StatusInternalServerError ||
+		r.Path != "/user/1?a=b" || !strings.Contains(r.Stack, "error_report_test.go") || r.TraceID == "" {
+		t.Errorf("panic: %+v", r)
+	}
+	if r := reports[1]; r.Status != http.StatusBadGateway || r.Error != "upstream" || r.Stack != "" {
+		t.Errorf("5xx: %+v", r)
+	}
+	if r := reports[2]; r.Kind != "grpc" || r.Method != "GRPC" || r.Path != info.FullMethod ||
+		r.Status != http.StatusServiceUnavailable {
+		t.Errorf("grpc: %+v", r)
+	}
+	if r := reports[3]; r.Kind != "cron" || r.Error != "cron" || !strings.Contains(r.Path, "TestOnError") {
+		t.Errorf("cron: %+v", r)
+	}
+}
+
+func TestWebhookReporter(t *testing.T) {
+	var reports []*ErrorReport
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+		if err := encoding.JSON.Unmarshal(b, &reports); err != nil {
+			t.Error(err)
+		}
+	}))
+	defer ts.Close()
+
+	r := newWebhookReporter(ts.URL)
+	httpCtx := NewHTTPContext()
+	defer httpCtx.Cancel()
+	httpCtx.requestMethod, httpCtx.requestPath = "GRPC", "/test.Service/Call"
+	r.report(httpCtx, errors.New("a"), nil)
+	r.report(httpCtx, errors.New("a"), nil)
+	r.report(httpCtx, errors.New("b"), nil)
+	r.flush()
+
+	if len(reports) != 2 || reports[0].Error != "a" || reports[0].Count != 2 ||
+		reports[1].Error != "b" || reports[1].Count != 1 {
+		t.Errorf("reports: %+v", reports)
+	}
+
+	//已经上报的清空
+	reports = nil
+	r.flush()
+	if reports != nil {
+		t.Errorf("empty flush: %+v", reports)
+	}
+}
@@ -14,9 +14,11 @@ import (
 	"github.com/hsyan2008/hfw/grpc/balancer/p2c"
 	"github.com/hsyan2008/hfw/grpc/discovery"
 	"github.com/hsyan2008/hfw/grpc/discovery/resolver"
+	"github.com/hsyan2008/hfw/health"
 	grpc "google.golang.org/grpc"
 	"google.golang.org/grpc/balancer/roundrobin"
 	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/connectivity"
 	"google.golang.org/grpc/status"
 )
 
@@ -85,10 +87,37 @@ func GetConnWithAuth(ctx context.Context, c configs.GrpcConfig, authValue string
 	}
 
 	p.c = conn
+	registerHealthCheck(c)
 
 	return
 }
 
+//registerHealthCheck 连接失败的时候readiness返回失败，连接被移除后下次调用会重建，不算失败
+func registerHealthCheck(c configs.GrpcConfig) {
+	health.Register("grpc."+c.ServerName, func(context.Context) error {
+		lock.Lock()
+		p, ok := connInstanceMap[c.ResolverScheme]
+		lock.Unlock()
+		if !ok {
+			return nil
+		}
+		p.l.Lock()
+		conn := p.c
+		p.l.Unlock()
+		if conn == nil {
+			return nil
+		}
+		switch state := conn.GetState(); state {
+		case connectivity.TransientFailure, connectivity.Shutdown:
+			return errors.New("grpc connection state: " + state.String())
+		case connectivity.Idle:
+			conn.Connect()
+		}
+
+		return nil
+	})
+}
+
 func removeClientConn(c configs.GrpcConfig, err error) {
 	code := status.Code(err)
 	if code != codes.Unavailable {
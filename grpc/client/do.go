@@ -56,7 +56,16 @@ func Do(httpCtx *hfw.HTTPContext, c configs.GrpcConfig,
 		return nil, common.NewRespErr(500, err)
 	}
 
-	ctx, cancel := context.WithTimeout(httpCtx.Ctx, timeout)
+	//httpCtx有deadline的时候，以deadline为上限，timeout小于等于0则只使用deadline
+	var (
+		ctx    context.Context
+		cancel context.CancelFunc
+	)
+	if timeout > 0 {
+		ctx, cancel = context.WithTimeout(httpCtx.Ctx, timeout)
+	} else {
+		ctx, cancel = context.WithCancel(httpCtx.Ctx)
+	}
 	defer cancel()
 
 	md, ok := metadata.FromOutgoingContext(httpCtx.Ctx)
@@ -86,7 +95,7 @@ func Do(httpCtx *hfw.HTTPContext, c configs.GrpcConfig,
 				// removeClientConn(c, err)
 				return
 			}(httpCtx)
-			if err == nil || err == context.Canceled || err == context.DeadlineExceeded {
+			if err == nil || ctx.Err() != nil || err == context.Canceled || err == context.DeadlineExceeded {
 				return
 			}
 			if _, ok := err.(*common.RespErr); ok {
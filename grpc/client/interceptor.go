@@ -2,11 +2,16 @@ package client
 
 import (
 	"context"
+	"strings"
 
 	"github.com/hsyan2008/hfw"
 	"github.com/hsyan2008/hfw/common"
+	"github.com/hsyan2008/hfw/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
 	"google.golang.org/grpc/status"
 )
 
@@ -34,6 +39,12 @@ func UnaryClientInterceptor(ctx context.Context, method string, req, reply inter
 		}
 	}()
 
+	parent, span := startSpan(httpCtx, method)
+	defer func() {
+		httpCtx.Ctx = parent
+		endSpan(span, err)
+	}()
+
 	return invoker(httpCtx, method, req, reply, cc, opts...)
 }
 
@@ -50,5 +61,36 @@ func StreamClientInterceptor(ctx context.Context, desc *grpc.StreamDesc, cc *grp
 		}
 	}()
 
+	//只记录建立stream的过程
+	parent, span := startSpan(httpCtx, method)
+	defer func() {
+		httpCtx.Ctx = parent
+		endSpan(span, err)
+	}()
+
 	return streamer(httpCtx, desc, cc, method, opts...)
 }
+
+//startSpan 创建client span，并把traceparent写入outgoing metadata，返回原来的Ctx用于恢复
+func startSpan(httpCtx *hfw.HTTPContext, method string) (parent context.Context, span trace.Span) {
+	parent = httpCtx.Ctx
+	ctx, span := tracing.Start(parent, strings.TrimPrefix(method, "/"), trace.SpanKindClient,
+		attribute.String("rpc.system", "grpc"),
+		attribute.String("rpc.method", method),
+	)
+	md, ok := metadata.FromOutgoingContext(ctx)
+	if ok {
+		md = md.Copy()
+	} else {
+		md = metadata.MD{}
+	}
+	tracing.InjectMetadata(ctx, md)
+	httpCtx.Ctx = metadata.NewOutgoingContext(ctx, md)
+
+	return
+}
+
+func endSpan(span trace.Span, err error) {
+	span.SetAttributes(attribute.Int64("rpc.grpc.status_code", int64(status.Code(err))))
+	tracing.End(span, err)
+}
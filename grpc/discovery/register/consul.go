@@ -103,16 +103,11 @@ func (cr *ConsulRegister) Register(info common.RegisterInfo) (err error) {
 		}
 	}()
 
-	signal.GetSignalContext().WgAdd()
-
 	return nil
 }
 
 func (cr *ConsulRegister) UnRegister() (err error) {
-	defer func() {
-		signal.GetSignalContext().WgDone()
-		cr.cancel()
-	}()
+	defer cr.cancel()
 
 	err = cr.client.Agent().ServiceDeregister(cr.serviceID)
 	if err != nil {
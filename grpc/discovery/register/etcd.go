@@ -93,8 +93,6 @@ func (er *EtcdRegister) Register(info common.RegisterInfo) (err error) {
 		}
 	}()
 
-	signal.GetSignalContext().WgAdd()
-
 	return nil
 }
 
@@ -119,10 +117,7 @@ func (er *EtcdRegister) withAlive() error {
 // UnRegister remove service from etcd
 func (er *EtcdRegister) UnRegister() (err error) {
 	if er.client != nil {
-		defer func() {
-			signal.GetSignalContext().WgDone()
-			er.cancel()
-		}()
+		defer er.cancel()
 		_, err = er.client.Delete(context.Background(), er.key)
 	}
 
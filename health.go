@@ -0,0 +1,114 @@
+package hfw
+
+import (
+	"context"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/hsyan2008/hfw/configs"
+	"github.com/hsyan2008/hfw/encoding"
+	"github.com/hsyan2008/hfw/health"
+	"github.com/hsyan2008/hfw/signal"
+	"google.golang.org/grpc"
+	grpchealth "google.golang.org/grpc/health"
+	"google.golang.org/grpc/health/grpc_health_v1"
+)
+
+//HealthCheck readiness的检查，返回error表示不可用，ctx有Health.Timeout的超时
+type HealthCheck = health.Check
+
+var (
+	//退出的时候置为1，readiness返回失败
+	notReady int32
+
+	grpcHealth *grpchealth.Server
+)
+
+//RegisterHealthCheck 注册readiness的检查，name相同的会覆盖，同health.Register
+//默认的redis、db，以及nosql、grpc/client创建连接的时候会自动注册
+func RegisterHealthCheck(name string, check HealthCheck) {
+	health.Register(name, check)
+}
+
+//checkHealth 退出的时候直接返回shutting_down，否则执行所有的检查
+func checkHealth(ctx context.Context, timeout time.Duration) *health.Report {
+	if atomic.LoadInt32(&notReady) == 1 {
+		return &health.Report{Status: health.StatusShuttingDown, Checks: make(map[string]*health.Result)}
+	}
+
+	return health.Run(ctx, timeout)
+}
+
+//initHealth 按Health的配置注册http的路由，退出的时候先让readiness返回失败
+func initHealth(c configs.HealthConfig) {
+	if !c.IsEnable {
+		return
+	}
+
+	//不经过中间件，避免访问日志和监控被探测请求刷屏
+	http.HandleFunc(c.LivePath, func(w http.ResponseWriter, r *http.Request) {
+		writeHealth(w, &health.Report{Status: health.StatusOK})
+	})
+	http.HandleFunc(c.ReadyPath, func(w http.ResponseWriter, r *http.Request) {
+		writeHealth(w, checkHealth(r.Context(), configs.Get().Health.Timeout))
+	})
+
+	signal.OnShutdown("readiness", signal.PriorityNotReady, notReadyHook(c.ShutdownDelay))
+}
+
+//notReadyHook readiness返回失败后等待delay，http服务在之后的PriorityStopAccept才关闭listener
+func notReadyHook(delay time.Duration) func(ctx context.Context) error {
+	return func(ctx context.Context) error {
+		atomic.StoreInt32(&notReady, 1)
+		if grpcHealth != nil {
+			grpcHealth.Shutdown()
+		}
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+		}
+		return nil
+	}
+}
+
+func writeHealth(w http.ResponseWriter, report *health.Report) {
+	b, err := encoding.JSON.Marshal(report)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", MIMEJSON+"; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	if report.Status != health.StatusOK {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	_, _ = w.Write(b)
+}
+
+//GetGrpcHealthServer 开启Health后NewGrpcServer注册的grpc.health.v1服务，可以设置各个服务的状态
+func GetGrpcHealthServer() *grpchealth.Server {
+	return grpcHealth
+}
+
+//grpcHealthServer 整体的状态(service为空)执行注册的检查，其他服务使用SetServingStatus设置的状态
+type grpcHealthServer struct {
+	*grpchealth.Server
+}
+
+func registerGrpcHealth(s *grpc.Server) {
+	grpcHealth = grpchealth.NewServer()
+	grpc_health_v1.RegisterHealthServer(s, &grpcHealthServer{grpcHealth})
+}
+
+func (s *grpcHealthServer) Check(ctx context.Context, req *grpc_health_v1.HealthCheckRequest) (*grpc_health_v1.HealthCheckResponse, error) {
+	if req.GetService() != "" {
+		return s.Server.Check(ctx, req)
+	}
+	status := grpc_health_v1.HealthCheckResponse_SERVING
+	if checkHealth(ctx, configs.Get().Health.Timeout).Status != health.StatusOK {
+		status = grpc_health_v1.HealthCheckResponse_NOT_SERVING
+	}
+
+	return &grpc_health_v1.HealthCheckResponse{Status: status}, nil
+}
@@ -0,0 +1,105 @@
+//Package health readiness检查的注册表，不依赖hfw，nosql、grpc/client等包可以直接注册
+//hfw的ReadyPath和grpc.health.v1使用Run执行所有的检查
+package health
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+)
+
+//Check readiness的检查，返回error表示不可用，ctx有超时
+type Check func(ctx context.Context) error
+
+const (
+	StatusOK           = "ok"
+	StatusFail         = "fail"
+	StatusShuttingDown = "shutting_down"
+)
+
+//Result 单个检查的结果，耗时的单位是毫秒
+type Result struct {
+	Status  string  `json:"status"`
+	Latency float64 `json:"latency_ms"`
+	Error   string  `json:"error,omitempty"`
+}
+
+type Report struct {
+	Status string             `json:"status"`
+	Checks map[string]*Result `json:"checks,omitempty"`
+}
+
+var (
+	mu     sync.RWMutex
+	checks = make(map[string]Check)
+)
+
+//Register 注册readiness的检查，name相同的会覆盖
+func Register(name string, check Check) {
+	mu.Lock()
+	defer mu.Unlock()
+	checks[name] = check
+}
+
+//Unregister 删除name的检查，如连接关闭的时候
+func Unregister(name string) {
+	mu.Lock()
+	defer mu.Unlock()
+	delete(checks, name)
+}
+
+//Run 并发执行所有的检查，超时的算失败
+func Run(ctx context.Context, timeout time.Duration) *Report {
+	report := &Report{Status: StatusOK, Checks: make(map[string]*Result)}
+
+	mu.RLock()
+	names := make([]string, 0, len(checks))
+	list := make([]Check, 0, len(checks))
+	for name := range checks {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		list = append(list, checks[name])
+	}
+	mu.RUnlock()
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	results := make([]*Result, len(list))
+	var wg sync.WaitGroup
+	for i, check := range list {
+		wg.Add(1)
+		go func(i int, check Check) {
+			defer wg.Done()
+			startTime := time.Now()
+			//检查不一定支持ctx，所以单独等待超时
+			c := make(chan error, 1)
+			go func() {
+				c <- check(ctx)
+			}()
+			var err error
+			select {
+			case err = <-c:
+			case <-ctx.Done():
+				err = ctx.Err()
+			}
+			results[i] = &Result{Status: StatusOK, Latency: float64(time.Since(startTime).Microseconds()) / 1000}
+			if err != nil {
+				results[i].Status, results[i].Error = StatusFail, err.Error()
+			}
+		}(i, check)
+	}
+	wg.Wait()
+
+	for i, name := range names {
+		report.Checks[name] = results[i]
+		if results[i].Status != StatusOK {
+			report.Status = StatusFail
+		}
+	}
+
+	return report
+}
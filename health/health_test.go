@@ -0,0 +1,38 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestRun(t *testing.T) {
+	old := checks
+	defer func() {
+		checks = old
+	}()
+	checks = make(map[string]Check)
+
+	Register("ok", func(context.Context) error {
+		return nil
+	})
+	report := Run(context.Background(), time.Second)
+	if report.Status != StatusOK || report.Checks["ok"].Status != StatusOK {
+		t.Errorf("ok: %+v", report)
+	}
+
+	Register("fail", func(context.Context) error {
+		return errors.New("down")
+	})
+	//不支持ctx的检查也按超时返回
+	Register("slow", func(context.Context) error {
+		time.Sleep(time.Second)
+		return nil
+	})
+	report = Run(context.Background(), 50*time.Millisecond)
+	if report.Status != StatusFail || report.Checks["ok"].Status != StatusOK ||
+		report.Checks["fail"].Error != "down" || report.Checks["slow"].Error != context.DeadlineExceeded.Error() {
+		t.Errorf("fail: %+v", report)
+	}
+}
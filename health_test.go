@@ -0,0 +1,104 @@
+package hfw
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/hsyan2008/hfw/configs"
+	"github.com/hsyan2008/hfw/health"
+	grpchealth "google.golang.org/grpc/health"
+	"google.golang.org/grpc/health/grpc_health_v1"
+)
+
+func TestCheckHealth(t *testing.T) {
+	defer func() {
+		health.Unregister("test.fail")
+		atomic.StoreInt32(&notReady, 0)
+	}()
+
+	RegisterHealthCheck("test.fail", func(context.Context) error {
+		return errors.New("down")
+	})
+	report := checkHealth(context.Background(), time.Second)
+	if report.Status != health.StatusFail || report.Checks["test.fail"].Error != "down" {
+		t.Errorf("fail: %+v", report)
+	}
+
+	w := httptest.NewRecorder()
+	writeHealth(w, report)
+	if w.Code != http.StatusServiceUnavailable || !strings.Contains(w.Body.String(), `"test.fail":{"status":"fail"`) {
+		t.Errorf("http: %d %s", w.Code, w.Body.String())
+	}
+
+	s := &grpcHealthServer{grpchealth.NewServer()}
+	rs, err := s.Check(context.Background(), &grpc_health_v1.HealthCheckRequest{})
+	if err != nil || rs.Status != grpc_health_v1.HealthCheckResponse_NOT_SERVING {
+		t.Errorf("grpc: %v %v", rs, err)
+	}
+
+	//退出的时候不再执行检查
+	atomic.StoreInt32(&notReady, 1)
+	report = checkHealth(context.Background(), time.Second)
+	if report.Status != health.StatusShuttingDown || len(report.Checks) != 0 {
+		t.Errorf("shutting down: %+v", report)
+	}
+}
+
+//退出的时候readiness先返回失败，等待ShutdownDelay后http服务才在PriorityStopAccept关闭listener
+func TestNotReadyBeforeStopAccept(t *testing.T) {
+	defer atomic.StoreInt32(&notReady, 0)
+	initHealth(configs.HealthConfig{IsEnable: true, LivePath: "/test/healthz", ReadyPath: "/test/readyz"})
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := &http.Server{Handler: new(newMux)}
+	go func() { _ = srv.Serve(ln) }()
+	client := &http.Client{Transport: &http.Transport{DisableKeepAlives: true}}
+	get := func() (int, error) {
+		resp, err := client.Get("http://" + ln.Addr().String() + "/test/readyz")
+		if err != nil {
+			return 0, err
+		}
+		resp.Body.Close()
+		return resp.StatusCode, nil
+	}
+
+	if code, err := get(); err != nil || code != http.StatusOK {
+		t.Fatalf("ready: %d %v", code, err)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		_ = notReadyHook(200 * time.Millisecond)(context.Background())
+		close(done)
+	}()
+	for atomic.LoadInt32(&notReady) == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	//新的连接依然可以建立，readiness返回失败
+	if code, err := get(); err != nil || code != http.StatusServiceUnavailable {
+		t.Errorf("not ready: %d %v", code, err)
+	}
+	select {
+	case <-done:
+		t.Fatal("hook should wait ShutdownDelay")
+	default:
+	}
+
+	<-done
+	if err := srv.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := get(); err == nil {
+		t.Error("listener should be closed")
+	}
+}
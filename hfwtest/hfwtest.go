@@ -0,0 +1,151 @@
+//Package hfwtest 在进程内启动已注册的路由和grpc服务，用于写controller和grpc的测试
+//
+//	s := hfwtest.New(t)
+//	var v User
+//	s.Get("/user/info").WithQuery("id", "1").ExpectStatus(200).ExpectErrNo(0).DecodeResults(&v)
+package hfwtest
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/cookiejar"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/hsyan2008/hfw"
+	"github.com/hsyan2008/hfw/common"
+	"github.com/hsyan2008/hfw/configs"
+	"github.com/hsyan2008/hfw/session"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+const bufSize = 1 << 20
+
+//Server 使用http.DefaultServeMux，hfw.Handler、HandlerFunc等注册的路由都可以访问
+//session使用内存存储，cookie在同一个Server的请求之间保持
+type Server struct {
+	*httptest.Server
+	Client *http.Client
+
+	t     testing.TB
+	store session.Store
+}
+
+//New 启动服务，测试结束的时候自动关闭
+func New(t testing.TB) *Server {
+	t.Helper()
+	jar, err := cookiejar.New(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &Server{
+		Server: httptest.NewServer(http.DefaultServeMux),
+		t:      t,
+		store:  session.NewSessMemoryStore(),
+	}
+	s.Client = s.Server.Client()
+	s.Client.Jar = jar
+	//和curl一样，不自动跟随跳转，方便断言
+	s.Client.CheckRedirect = func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}
+	hfw.SetSessionStore(s.store)
+
+	t.Cleanup(func() {
+		s.Close()
+		hfw.SetSessionStore(nil)
+	})
+
+	return s
+}
+
+//EnableSession 开启session，测试结束的时候恢复
+func (s *Server) EnableSession() *Server {
+	c := *configs.Get()
+	c.Session.IsEnable = true
+	old := configs.Set(&c)
+	s.t.Cleanup(func() {
+		configs.Set(old)
+	})
+
+	return s
+}
+
+//GetSession 获取当前cookie对应的session里的值，不存在返回false
+func (s *Server) GetSession(value interface{}, key string) bool {
+	s.t.Helper()
+	id := s.sessionID(false)
+	if id == "" {
+		return false
+	}
+	if ok, _ := s.store.IsExist(id, key); !ok {
+		return false
+	}
+	if err := s.store.Get(value, id, key); err != nil {
+		s.t.Fatalf("get session %s: %v", key, err)
+	}
+
+	return true
+}
+
+//sessionID 从cookie获取session id，没有的时候按需生成并写入cookie
+func (s *Server) sessionID(create bool) string {
+	u, _ := url.Parse(s.URL)
+	name := sessionCookieName()
+	for _, c := range s.Client.Jar.Cookies(u) {
+		if c.Name == name {
+			return c.Value
+		}
+	}
+	if !create {
+		return ""
+	}
+	id := common.Uuid()
+	s.Client.Jar.SetCookies(u, []*http.Cookie{{Name: name, Value: id, Path: "/"}})
+
+	return id
+}
+
+func sessionCookieName() string {
+	if name := configs.Get().Session.CookieName; name != "" {
+		return name
+	}
+
+	return "sess_name"
+}
+
+//StartGrpc 在内存里启动grpc服务，使用hfw的拦截器和中间件，返回连接好的客户端
+//register里注册服务，测试结束的时候自动关闭
+func (s *Server) StartGrpc(register func(*grpc.Server), opt ...grpc.ServerOption) *grpc.ClientConn {
+	s.t.Helper()
+	lis := bufconn.Listen(bufSize)
+	gs := grpc.NewServer(append([]grpc.ServerOption{
+		grpc.UnaryInterceptor(hfw.UnaryServerInterceptor),
+		grpc.StreamInterceptor(hfw.StreamServerInterceptor),
+	}, opt...)...)
+	register(gs)
+	go func() {
+		_ = gs.Serve(lis)
+	}()
+
+	conn, err := grpc.DialContext(context.Background(), "bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return lis.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	if err != nil {
+		gs.Stop()
+		s.t.Fatal(err)
+	}
+	s.t.Cleanup(func() {
+		_ = conn.Close()
+		gs.Stop()
+	})
+
+	return conn
+}
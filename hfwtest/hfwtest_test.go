@@ -0,0 +1,77 @@
+package hfwtest
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/hsyan2008/hfw"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/health"
+	"google.golang.org/grpc/health/grpc_health_v1"
+)
+
+type userController struct {
+	hfw.Controller
+}
+
+func (ctl *userController) Info(httpCtx *hfw.HTTPContext) {
+	var req struct {
+		ID int `json:"id" validate:"required"`
+	}
+	httpCtx.Bind(&req)
+	var name string
+	httpCtx.Session.Get(&name, "name")
+	httpCtx.Results = map[string]interface{}{"id": req.ID, "name": name}
+}
+
+func (ctl *userController) Login(httpCtx *hfw.HTTPContext) {
+	httpCtx.Session.Set("uid", 1)
+}
+
+func init() {
+	_ = hfw.Handler("/hfwtest/user", &userController{})
+	hfw.HandlerFunc("/hfwtest/ping", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Pong", "1")
+		_, _ = w.Write([]byte("pong"))
+	})
+}
+
+func TestServer(t *testing.T) {
+	s := New(t).EnableSession()
+
+	var v struct {
+		ID   int    `json:"id"`
+		Name string `json:"name"`
+	}
+	s.Post("/hfwtest/user/info").WithJSON(map[string]int{"id": 3}).WithSession("name", "tom").
+		ExpectStatus(http.StatusOK).ExpectErrNo(0).DecodeResults(&v)
+	if v.ID != 3 || v.Name != "tom" {
+		t.Errorf("results: %+v", v)
+	}
+
+	s.Get("/hfwtest/user/info").ExpectStatus(http.StatusOK).ExpectErrNo(400)
+
+	s.Get("/hfwtest/user/login").ExpectStatus(http.StatusOK)
+	var uid int
+	if !s.GetSession(&uid, "uid") || uid != 1 {
+		t.Errorf("session uid: %d", uid)
+	}
+
+	s.Get("/hfwtest/ping").ExpectStatus(http.StatusOK).ExpectHeader("X-Pong", "1").ExpectContains("pong")
+}
+
+func TestStartGrpc(t *testing.T) {
+	s := New(t)
+	conn := s.StartGrpc(func(gs *grpc.Server) {
+		grpc_health_v1.RegisterHealthServer(gs, health.NewServer())
+	})
+
+	rs, err := grpc_health_v1.NewHealthClient(conn).Check(context.Background(), &grpc_health_v1.HealthCheckRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rs.Status != grpc_health_v1.HealthCheckResponse_SERVING {
+		t.Errorf("status: %s", rs.Status)
+	}
+}
@@ -0,0 +1,160 @@
+package hfwtest
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/hsyan2008/hfw/encoding"
+)
+
+//Request 链式设置请求，ExpectStatus或者Do的时候发送
+type Request struct {
+	s *Server
+
+	method string
+	path   string
+	header http.Header
+	query  url.Values
+	body   []byte
+
+	cookies []*http.Cookie
+	session map[string]interface{}
+}
+
+//Get ..
+func (s *Server) Get(path string) *Request {
+	return s.NewRequest(http.MethodGet, path)
+}
+
+//Post ..
+func (s *Server) Post(path string) *Request {
+	return s.NewRequest(http.MethodPost, path)
+}
+
+//Put ..
+func (s *Server) Put(path string) *Request {
+	return s.NewRequest(http.MethodPut, path)
+}
+
+//Delete ..
+func (s *Server) Delete(path string) *Request {
+	return s.NewRequest(http.MethodDelete, path)
+}
+
+//NewRequest path可以带query
+func (s *Server) NewRequest(method, path string) *Request {
+	return &Request{
+		s:       s,
+		method:  method,
+		path:    path,
+		header:  http.Header{},
+		query:   url.Values{},
+		session: make(map[string]interface{}),
+	}
+}
+
+//WithHeader ..
+func (r *Request) WithHeader(key, value string) *Request {
+	r.header.Set(key, value)
+	return r
+}
+
+//WithQuery 追加到path的query后面
+func (r *Request) WithQuery(key, value string) *Request {
+	r.query.Add(key, value)
+	return r
+}
+
+//WithJSON body是v的json
+func (r *Request) WithJSON(v interface{}) *Request {
+	r.s.t.Helper()
+	b, err := encoding.JSON.Marshal(v)
+	if err != nil {
+		r.s.t.Fatalf("marshal json: %v", err)
+	}
+	return r.WithBody("application/json", b)
+}
+
+//WithForm body是x-www-form-urlencoded
+func (r *Request) WithForm(values url.Values) *Request {
+	return r.WithBody("application/x-www-form-urlencoded", []byte(values.Encode()))
+}
+
+//WithBody ..
+func (r *Request) WithBody(contentType string, body []byte) *Request {
+	r.header.Set("Content-Type", contentType)
+	r.body = body
+	return r
+}
+
+//WithCookie 只用于本次请求，响应设置的cookie会保存到Server里
+func (r *Request) WithCookie(cookie *http.Cookie) *Request {
+	r.cookies = append(r.cookies, cookie)
+	return r
+}
+
+//WithSession 发送前写入session，需要先调用Server.EnableSession
+func (r *Request) WithSession(key string, value interface{}) *Request {
+	r.session[key] = value
+	return r
+}
+
+//ExpectStatus 发送请求并断言状态码
+func (r *Request) ExpectStatus(code int) *Response {
+	r.s.t.Helper()
+	return r.Do().ExpectStatus(code)
+}
+
+//Do 发送请求，读取全部body
+func (r *Request) Do() *Response {
+	t := r.s.t
+	t.Helper()
+
+	if len(r.session) > 0 {
+		id := r.s.sessionID(true)
+		for k, v := range r.session {
+			if err := r.s.store.Put(id, k, v); err != nil {
+				t.Fatalf("put session %s: %v", k, err)
+			}
+		}
+	}
+
+	u := r.s.URL + r.path
+	if len(r.query) > 0 {
+		if strings.Contains(u, "?") {
+			u += "&" + r.query.Encode()
+		} else {
+			u += "?" + r.query.Encode()
+		}
+	}
+	req, err := http.NewRequest(r.method, u, bytes.NewReader(r.body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for k, v := range r.header {
+		req.Header[k] = v
+	}
+	for _, c := range r.cookies {
+		req.AddCookie(c)
+	}
+
+	rs, err := r.s.Client.Do(req)
+	if err != nil {
+		t.Fatalf("%s %s: %v", r.method, r.path, err)
+	}
+	defer rs.Body.Close()
+	body, err := io.ReadAll(rs.Body)
+	if err != nil {
+		t.Fatalf("%s %s read body: %v", r.method, r.path, err)
+	}
+
+	return &Response{
+		Response: rs,
+		Body:     body,
+		t:        t,
+		name:     r.method + " " + r.path,
+	}
+}
@@ -0,0 +1,120 @@
+package hfwtest
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/hsyan2008/hfw/encoding"
+)
+
+//Response 断言失败的时候调用t.Errorf，可以继续链式调用
+type Response struct {
+	*http.Response
+	//已经读取的全部body
+	Body []byte
+
+	t    testing.TB
+	name string
+
+	envelope *envelope
+}
+
+//envelope 输出的err_no、err_msg和results，HasHeader的时候在response里
+type envelope struct {
+	ErrNo    int64           `json:"err_no"`
+	ErrMsg   string          `json:"err_msg"`
+	Results  json.RawMessage `json:"results"`
+	Response *envelope       `json:"response"`
+}
+
+//String 返回body
+func (rs *Response) String() string {
+	return string(rs.Body)
+}
+
+//ExpectStatus ..
+func (rs *Response) ExpectStatus(code int) *Response {
+	rs.t.Helper()
+	if rs.StatusCode != code {
+		rs.t.Errorf("%s: status %d, want %d, body: %s", rs.name, rs.StatusCode, code, rs.Body)
+	}
+	return rs
+}
+
+//ExpectHeader ..
+func (rs *Response) ExpectHeader(key, value string) *Response {
+	rs.t.Helper()
+	if v := rs.Header.Get(key); v != value {
+		rs.t.Errorf("%s: header %s is %q, want %q", rs.name, key, v, value)
+	}
+	return rs
+}
+
+//ExpectContains 断言body包含s
+func (rs *Response) ExpectContains(s string) *Response {
+	rs.t.Helper()
+	if !bytes.Contains(rs.Body, []byte(s)) {
+		rs.t.Errorf("%s: body does not contain %q, body: %s", rs.name, s, rs.Body)
+	}
+	return rs
+}
+
+//ExpectErrNo 断言err_no
+func (rs *Response) ExpectErrNo(errNo int64) *Response {
+	rs.t.Helper()
+	if e := rs.getEnvelope(); e != nil && e.ErrNo != errNo {
+		rs.t.Errorf("%s: err_no %d, want %d, err_msg: %s", rs.name, e.ErrNo, errNo, e.ErrMsg)
+	}
+	return rs
+}
+
+//ExpectErrMsg 断言err_msg
+func (rs *Response) ExpectErrMsg(errMsg string) *Response {
+	rs.t.Helper()
+	if e := rs.getEnvelope(); e != nil && e.ErrMsg != errMsg {
+		rs.t.Errorf("%s: err_msg %q, want %q", rs.name, e.ErrMsg, errMsg)
+	}
+	return rs
+}
+
+//DecodeResults 把results解析到v
+func (rs *Response) DecodeResults(v interface{}) *Response {
+	rs.t.Helper()
+	e := rs.getEnvelope()
+	if e == nil {
+		return rs
+	}
+	if err := encoding.JSON.Unmarshal(e.Results, v); err != nil {
+		rs.t.Errorf("%s: decode results: %v, results: %s", rs.name, err, e.Results)
+	}
+	return rs
+}
+
+//Decode 把整个body解析到v，用于IsOnlyResults等不是标准结构的输出
+func (rs *Response) Decode(v interface{}) *Response {
+	rs.t.Helper()
+	if err := encoding.JSON.Unmarshal(rs.Body, v); err != nil {
+		rs.t.Errorf("%s: decode body: %v, body: %s", rs.name, err, rs.Body)
+	}
+	return rs
+}
+
+func (rs *Response) getEnvelope() *envelope {
+	rs.t.Helper()
+	if rs.envelope != nil {
+		return rs.envelope
+	}
+	e := &envelope{}
+	if err := encoding.JSON.Unmarshal(rs.Body, e); err != nil {
+		rs.t.Errorf("%s: not json response: %v, body: %s", rs.name, err, rs.Body)
+		return nil
+	}
+	if e.Response != nil {
+		e = e.Response
+	}
+	rs.envelope = e
+
+	return e
+}
@@ -1,8 +1,10 @@
 package hfw
 
 import (
+	"context"
 	"errors"
 	"fmt"
+	"os"
 	"path/filepath"
 	"strings"
 	"testing"
@@ -13,11 +15,14 @@ import (
 	"github.com/hsyan2008/hfw/db"
 	"github.com/hsyan2008/hfw/prometheus"
 	"github.com/hsyan2008/hfw/redis"
+	"github.com/hsyan2008/hfw/signal"
+	"github.com/hsyan2008/hfw/tracing"
+	radix "github.com/mediocregopher/radix/v3"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 )
 
 var (
-	//废弃，请用configs.Config
+	//启动时的配置，Reload不会修改，运行中请用configs.Get()
 	Config   configs.AllConfig
 	isInited bool
 )
@@ -44,12 +49,40 @@ func Init() (err error) {
 	}
 	Config = configs.Config
 
+	//输出最终的配置后退出
+	if common.IsDumpConfig() {
+		err = configs.Dump(os.Stdout, &Config)
+		if err != nil {
+			logger.Warn(err)
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}
+
 	err = initLog()
 	if err != nil {
 		logger.Warn(err)
 		return err
 	}
 
+	//错误上报
+	err = initErrorReport(Config.ErrorReport)
+	if err != nil {
+		logger.Warn("init error report faild:", err)
+		return err
+	}
+
+	signal.SetShutdownTimeout(Config.Server.ShutdownTimeout)
+
+	//初始化链路追踪
+	if Config.Trace.IsEnable {
+		err = tracing.Init(Config.Trace)
+		if err != nil {
+			logger.Warn("init trace faild:", err)
+			return err
+		}
+	}
+
 	//初始化redis
 	if len(Config.Redis.Addresses) > 0 {
 		logger.Info("begin to connect default REDIS server:", Config.Redis.Addresses)
@@ -59,19 +92,46 @@ func Init() (err error) {
 			return fmt.Errorf("connect to default redis faild: %s", err.Error())
 		}
 		logger.Info("connect to default REDIS server success")
+		RegisterHealthCheck("redis", func(ctx context.Context) error {
+			return redis.DefaultIns.WithContext(ctx).Do(radix.Cmd(nil, "PING"))
+		})
 	}
 
 	//初始化mysql
 	if Config.Db.Driver != "" {
 		logger.Info("begin connect to default MYSQL server:", Config.Db.Address)
-		db.DefaultDao, err = db.NewXormDao(Config, Config.Db)
+		var dao *db.XormDao
+		dao, err = db.NewXormDao(Config, Config.Db)
+		db.DefaultDao = dao
 		if err != nil {
 			logger.Warn("connect to default MYSQL faild:", err)
 			return fmt.Errorf("connect to default mysql faild: %s", err.Error())
 		}
 		logger.Info("connect to default MYSQL server success")
+		RegisterHealthCheck("db.master", dao.PingMaster)
+		for i := range Config.Db.Slaves {
+			i := i
+			RegisterHealthCheck(fmt.Sprintf("db.slave%d", i), func(ctx context.Context) error {
+				return dao.PingSlave(ctx, i)
+			})
+		}
 	}
 
+	//限流规则
+	SetLimitRules(Config.Limit.Rules)
+	err = SetTrustedProxies(Config.Limit.TrustedProxies)
+	if err != nil {
+		logger.Warn(err)
+		return err
+	}
+	SetAdaptiveLimit(Config.Limit.Adaptive)
+
+	//健康检查
+	initHealth(Config.Health)
+
+	//配置热加载
+	initReload(Config.Reload)
+
 	//初始化prometheus
 	if Config.Prometheus.IsEnable {
 		prometheus.Init(Config.Prometheus)
@@ -84,6 +144,16 @@ func Init() (err error) {
 //setLog 初始化log写入文件
 func initLog() error {
 	lc := Config.Logger
+	err := setLogger(lc)
+	if err != nil {
+		return err
+	}
+
+	return initAccessLog(lc)
+}
+
+//setLogger 设置logger，Reload的时候也会调用
+func setLogger(lc configs.LoggerConfig) error {
 	logger.SetLogGoID(lc.LogGoID)
 
 	if len(lc.LogFile) > 0 {
@@ -0,0 +1,331 @@
+package hfw
+
+import (
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hsyan2008/hfw/common"
+	"github.com/hsyan2008/hfw/configs"
+	"github.com/hsyan2008/hfw/prometheus"
+	"google.golang.org/grpc/peer"
+)
+
+//LimitKeyFunc 返回限流的key，key相同的请求共享并发数和令牌桶
+type LimitKeyFunc func(httpCtx *HTTPContext) string
+
+//空闲的key多久清理一次
+const limitSweepInterval = time.Minute
+
+var (
+	limitKeyFuncs = map[string]LimitKeyFunc{
+		"route": func(httpCtx *HTTPContext) string {
+			if httpCtx.Route != "" {
+				return httpCtx.Route
+			}
+			return httpCtx.requestPath
+		},
+		"ip": limitClientIP,
+	}
+	limiters       []*limiter
+	trustedProxies []*net.IPNet
+	limitMu        = new(sync.RWMutex)
+)
+
+//RegisterLimitKeyFunc 注册限流维度，规则里的KeyBy使用name
+func RegisterLimitKeyFunc(name string, f LimitKeyFunc) {
+	limitMu.Lock()
+	defer limitMu.Unlock()
+	limitKeyFuncs[name] = f
+}
+
+//SetLimitRules 替换限流规则，Init的时候使用Limit.Rules
+func SetLimitRules(rules []configs.LimitRule) {
+	list := make([]*limiter, 0, len(rules))
+	for _, rule := range rules {
+		if rule.Concurrence == 0 && rule.Rate <= 0 {
+			continue
+		}
+		list = append(list, newLimiter(rule))
+	}
+
+	limitMu.Lock()
+	defer limitMu.Unlock()
+	limiters = list
+}
+
+//SetTrustedProxies 替换可信的代理，Init的时候使用Limit.TrustedProxies
+func SetTrustedProxies(proxies []string) error {
+	list := make([]*net.IPNet, 0, len(proxies))
+	for _, proxy := range proxies {
+		if !strings.Contains(proxy, "/") {
+			if strings.Contains(proxy, ":") {
+				proxy += "/128"
+			} else {
+				proxy += "/32"
+			}
+		}
+		_, ipNet, err := net.ParseCIDR(proxy)
+		if err != nil {
+			return fmt.Errorf("invalid trusted proxy: %s", proxy)
+		}
+		list = append(list, ipNet)
+	}
+
+	limitMu.Lock()
+	defer limitMu.Unlock()
+	trustedProxies = list
+
+	return nil
+}
+
+//LimitMiddleware 按Limit.Rules限流，超过的返回429和Retry-After
+func LimitMiddleware(next ContextHandler) ContextHandler {
+	return func(httpCtx *HTTPContext) {
+		limitMu.RLock()
+		list := limiters
+		limitMu.RUnlock()
+		if len(list) == 0 {
+			next(httpCtx)
+			return
+		}
+
+		segments := splitPath(httpCtx.requestPath)
+		now := time.Now()
+		var acquired []*limiter
+		var keys []string
+		defer func() {
+			for i, l := range acquired {
+				l.release(keys[i])
+			}
+		}()
+		for _, l := range list {
+			if !l.match(segments, httpCtx.requestMethod) {
+				continue
+			}
+			key := l.key(httpCtx)
+			retryAfter, reason := l.acquire(key, now)
+			if reason != "" {
+				//前面的规则已经通过的，退回令牌
+				for i, a := range acquired {
+					a.refund(keys[i])
+				}
+				acquired = nil
+				httpCtx.Warnf("limit: %s reject %s by %s", l.name, key, reason)
+				prometheus.LimitRejected(httpCtx.requestPath, httpCtx.requestMethod, l.name, reason)
+				if httpCtx.ResponseWriter != nil {
+					httpCtx.ResponseWriter.Header().Set("Retry-After",
+						strconv.FormatInt(int64(math.Ceil(retryAfter.Seconds())), 10))
+				}
+				httpCtx.HTTPStatus = http.StatusTooManyRequests
+				httpCtx.ErrNo = http.StatusTooManyRequests
+				httpCtx.ErrMsg = "too many requests"
+				return
+			}
+			acquired = append(acquired, l)
+			keys = append(keys, key)
+		}
+
+		next(httpCtx)
+	}
+}
+
+type limiter struct {
+	rule   configs.LimitRule
+	name   string
+	prefix []string
+	burst  float64
+
+	mu        sync.Mutex
+	entries   map[string]*limitEntry
+	lastSweep time.Time
+}
+
+type limitEntry struct {
+	inflight uint
+	tokens   float64
+	//上次补充令牌的时间
+	last time.Time
+}
+
+func newLimiter(rule configs.LimitRule) *limiter {
+	method := rule.Method
+	if method == "" {
+		method = "*"
+	}
+	l := &limiter{
+		rule:      rule,
+		name:      fmt.Sprintf("%s %s", strings.ToUpper(method), "/"+strings.Join(splitPath(rule.Path), "/")),
+		prefix:    splitPath(rule.Path),
+		burst:     float64(rule.Burst),
+		entries:   make(map[string]*limitEntry),
+		lastSweep: time.Now(),
+	}
+	if l.burst <= 0 {
+		l.burst = math.Max(1, math.Ceil(rule.Rate))
+	}
+
+	return l
+}
+
+func (l *limiter) match(segments []string, method string) bool {
+	if l.rule.Method != "" && !strings.EqualFold(l.rule.Method, method) {
+		return false
+	}
+
+	return hasPathPrefix(segments, l.prefix)
+}
+
+func (l *limiter) key(httpCtx *HTTPContext) string {
+	if l.rule.KeyBy == "" {
+		return ""
+	}
+	limitMu.RLock()
+	f, ok := limitKeyFuncs[l.rule.KeyBy]
+	limitMu.RUnlock()
+	if !ok {
+		httpCtx.Warnf("limit: undefined KeyBy %s", l.rule.KeyBy)
+		return ""
+	}
+
+	return f(httpCtx)
+}
+
+//acquire reason不为空表示被拒绝，retryAfter是建议的重试时间
+func (l *limiter) acquire(key string, now time.Time) (retryAfter time.Duration, reason string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.sweep(now)
+	e, ok := l.entries[key]
+	if !ok {
+		e = &limitEntry{tokens: l.burst, last: now}
+		l.entries[key] = e
+	}
+
+	if l.rule.Concurrence > 0 && e.inflight >= l.rule.Concurrence {
+		return time.Second, "concurrence"
+	}
+	if l.rule.Rate > 0 {
+		e.tokens = math.Min(l.burst, e.tokens+now.Sub(e.last).Seconds()*l.rule.Rate)
+		e.last = now
+		if e.tokens < 1 {
+			return time.Duration((1 - e.tokens) / l.rule.Rate * float64(time.Second)), "rate"
+		}
+		e.tokens--
+	}
+	e.inflight++
+	prometheus.LimitInflight(l.name, 1)
+
+	return
+}
+
+func (l *limiter) release(key string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if e, ok := l.entries[key]; ok && e.inflight > 0 {
+		e.inflight--
+		prometheus.LimitInflight(l.name, -1)
+	}
+}
+
+//refund 后面的规则拒绝的时候，退回并发和令牌
+func (l *limiter) refund(key string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	e, ok := l.entries[key]
+	if !ok {
+		return
+	}
+	if e.inflight > 0 {
+		e.inflight--
+		prometheus.LimitInflight(l.name, -1)
+	}
+	if l.rule.Rate > 0 {
+		e.tokens = math.Min(l.burst, e.tokens+1)
+	}
+}
+
+//sweep 清理没有并发且令牌已满的key，避免按ip限流的时候一直增长
+func (l *limiter) sweep(now time.Time) {
+	if now.Sub(l.lastSweep) < limitSweepInterval {
+		return
+	}
+	l.lastSweep = now
+	for key, e := range l.entries {
+		if e.inflight > 0 {
+			continue
+		}
+		if l.rule.Rate > 0 && e.tokens+now.Sub(e.last).Seconds()*l.rule.Rate < l.burst {
+			continue
+		}
+		delete(l.entries, key)
+	}
+}
+
+//limitClientIP 按ip限流的key，RemoteAddr不是可信的代理的时候不使用代理头，避免伪造X-Forwarded-For绕过限流
+//X-Forwarded-For从右往左取第一个不是可信代理的ip
+func limitClientIP(httpCtx *HTTPContext) string {
+	r := httpCtx.Request
+	if r == nil {
+		return clientIP(httpCtx)
+	}
+	ip := r.RemoteAddr
+	if host, _, err := net.SplitHostPort(ip); err == nil {
+		ip = host
+	}
+	if !isTrustedProxy(ip) {
+		return ip
+	}
+
+	hops := strings.Split(r.Header.Get("X-Forwarded-For"), ",")
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop := strings.TrimSpace(hops[i])
+		if hop == "" {
+			continue
+		}
+		ip = hop
+		if !isTrustedProxy(hop) {
+			break
+		}
+	}
+
+	return ip
+}
+
+func isTrustedProxy(ip string) bool {
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return false
+	}
+	limitMu.RLock()
+	defer limitMu.RUnlock()
+	for _, ipNet := range trustedProxies {
+		if ipNet.Contains(parsed) {
+			return true
+		}
+	}
+
+	return false
+}
+
+//clientIP http取代理头或者RemoteAddr，grpc取peer的地址，不包含端口
+func clientIP(httpCtx *HTTPContext) (ip string) {
+	if httpCtx.Request != nil {
+		ip = common.GetClientIP(httpCtx.Request)
+		//X-Forwarded-For可能有多个，第一个是客户端
+		ip = strings.TrimSpace(strings.Split(ip, ",")[0])
+	} else if p, ok := peer.FromContext(httpCtx); ok {
+		ip = p.Addr.String()
+	}
+	if host, _, err := net.SplitHostPort(ip); err == nil {
+		ip = host
+	}
+
+	return
+}
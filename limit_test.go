@@ -0,0 +1,115 @@
+package hfw
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/hsyan2008/hfw/configs"
+)
+
+func TestLimiter(t *testing.T) {
+	l := newLimiter(configs.LimitRule{Path: "/export", Rate: 2, Concurrence: 1})
+	if l.name != "* /export" || l.burst != 2 {
+		t.Fatalf("error limiter: %s %v", l.name, l.burst)
+	}
+	if !l.match(splitPath("/Export/csv"), "GET") || l.match(splitPath("/exports"), "GET") {
+		t.Error("error match")
+	}
+
+	now := time.Now()
+	if _, reason := l.acquire("", now); reason != "" {
+		t.Fatal(reason)
+	}
+	if _, reason := l.acquire("", now); reason != "concurrence" {
+		t.Errorf("expect concurrence, got %q", reason)
+	}
+	l.release("")
+	if _, reason := l.acquire("", now); reason != "" {
+		t.Fatal(reason)
+	}
+	l.release("")
+	retryAfter, reason := l.acquire("", now)
+	if reason != "rate" || retryAfter != 500*time.Millisecond {
+		t.Errorf("expect rate, got %q %s", reason, retryAfter)
+	}
+	//补充令牌
+	if _, reason := l.acquire("", now.Add(time.Second)); reason != "" {
+		t.Errorf("refill: %q", reason)
+	}
+}
+
+func TestLimitMiddleware(t *testing.T) {
+	defer SetLimitRules(Config.Limit.Rules)
+	SetLimitRules([]configs.LimitRule{{Path: "/api", Method: "GET", Rate: 1, KeyBy: "ip"}})
+
+	serve := func(ip string, forwardedFor ...string) (*httptest.ResponseRecorder, bool) {
+		w := httptest.NewRecorder()
+		httpCtx := NewHTTPContext()
+		httpCtx.ResponseWriter = w
+		httpCtx.Request = httptest.NewRequest("GET", "/api/user", nil)
+		httpCtx.Request.RemoteAddr = ip + ":1234"
+		if len(forwardedFor) > 0 {
+			httpCtx.Request.Header.Set("X-Forwarded-For", forwardedFor[0])
+		}
+		httpCtx.requestPath, httpCtx.requestMethod = "/api/user", "GET"
+		done := runMiddlewares(httpCtx, []Middleware{LimitMiddleware}, func(*HTTPContext) {})
+		if !done {
+			w.WriteHeader(httpCtx.HTTPStatus)
+		}
+		return w, done
+	}
+
+	if _, done := serve("10.0.0.1"); !done {
+		t.Fatal("first request should pass")
+	}
+	w, done := serve("10.0.0.1")
+	if done || w.Code != http.StatusTooManyRequests || w.Header().Get("Retry-After") != "1" {
+		t.Errorf("expect 429, got %d %v", w.Code, w.Header())
+	}
+	if _, done := serve("10.0.0.2"); !done {
+		t.Error("other ip should pass")
+	}
+
+	//不是可信的代理，伪造的X-Forwarded-For无效
+	if _, done := serve("10.0.0.1", "1.1.1.1"); done {
+		t.Error("spoofed X-Forwarded-For should not bypass")
+	}
+
+	defer SetTrustedProxies(Config.Limit.TrustedProxies)
+	if err := SetTrustedProxies([]string{"10.0.0.0/8", "192.168.1.1"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, done := serve("10.0.0.1", "2.2.2.2, 192.168.1.1"); !done {
+		t.Error("client behind trusted proxy should pass")
+	}
+	if _, done := serve("10.0.0.3", "1.1.1.1, 2.2.2.2"); done {
+		t.Error("same client behind trusted proxy should be limited")
+	}
+	if SetTrustedProxies([]string{"a.b.c.d"}) == nil {
+		t.Error("invalid proxy should fail")
+	}
+}
+
+func TestLimitRefund(t *testing.T) {
+	defer SetLimitRules(Config.Limit.Rules)
+	SetLimitRules([]configs.LimitRule{{Path: "/api", Rate: 1}, {Path: "/api/export", Concurrence: 1}})
+	limitMu.RLock()
+	first, second := limiters[0], limiters[1]
+	limitMu.RUnlock()
+
+	//占满第二个规则的并发
+	if _, reason := second.acquire("", time.Now()); reason != "" {
+		t.Fatal(reason)
+	}
+	httpCtx := NewHTTPContext()
+	httpCtx.requestPath, httpCtx.requestMethod = "/api/export", "GET"
+	if runMiddlewares(httpCtx, []Middleware{LimitMiddleware}, func(*HTTPContext) {}) {
+		t.Fatal("expect reject by concurrence")
+	}
+	//第一个规则的令牌已退回
+	if e := first.entries[""]; e.tokens != 1 || e.inflight != 0 {
+		t.Errorf("not refunded: %+v", e)
+	}
+}
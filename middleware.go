@@ -0,0 +1,241 @@
+package hfw
+
+import (
+	"errors"
+	"net/http"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/hsyan2008/hfw/common"
+	"github.com/hsyan2008/hfw/prometheus"
+)
+
+//ContextHandler 中间件链里的处理函数
+type ContextHandler func(httpCtx *HTTPContext)
+
+//Middleware 包装ContextHandler，不调用next即中止后续的执行
+//中止的时候请设置httpCtx.HTTPStatus、ErrNo、ErrMsg，用于返回给客户端
+//http下，controller的中间件在Init之后、Before之前执行，中止后依然会执行Finish
+//grpc下，path是FullMethod，method是GRPC或者Stream
+type Middleware func(next ContextHandler) ContextHandler
+
+var (
+	//全局中间件，默认包含panic捕获、监控、并发控制、限流、自适应限流、超时、session和csrf校验
+	middlewares = []Middleware{RecoverMiddleware, MetricsMiddleware, ConcurrenceMiddleware,
+		LimitMiddleware, AdaptiveLimitMiddleware, TimeoutMiddleware, SessionMiddleware, CSRFMiddleware}
+	//按路由前缀注册的中间件
+	patternMiddlewares = make(map[string][]Middleware)
+	//按controller注册的中间件
+	controllerMiddlewares = make(map[string][]Middleware)
+
+	//注册中间件的时候清空
+	chainMu    sync.RWMutex
+	chainCache = make(map[chainKey][]Middleware)
+)
+
+type chainKey struct {
+	pattern        string
+	controllerName string
+	group          *RouterGroup
+}
+
+//resetChainCache 注册中间件后，之前生成的中间件链失效
+func resetChainCache() {
+	chainMu.Lock()
+	defer chainMu.Unlock()
+	chainCache = make(map[chainKey][]Middleware)
+}
+
+//Use 添加全局中间件，对Handler、HandlerFunc和grpc都生效
+func Use(mws ...Middleware) {
+	middlewares = append(middlewares, mws...)
+	resetChainCache()
+}
+
+//SetMiddlewares 替换全局中间件，可用于调整默认中间件的顺序或者去掉
+//注意去掉RecoverMiddleware后，HandlerFunc和grpc里的panic不会被捕获
+func SetMiddlewares(mws ...Middleware) {
+	middlewares = mws
+	resetChainCache()
+}
+
+//UsePattern 添加路由前缀中间件，前缀按段匹配，不区分大小写
+//如/admin对/admin和/admin/user生效，对/administrator不生效
+//Handler匹配的是注册时的pattern，HandlerFunc匹配的是注册时的pattern，grpc匹配的是FullMethod
+func UsePattern(pattern string, mws ...Middleware) {
+	key := strings.Join(splitPath(pattern), "/")
+	patternMiddlewares[key] = append(patternMiddlewares[key], mws...)
+	resetChainCache()
+}
+
+//UseController 添加controller中间件，对注册了该controller的所有pattern生效
+func UseController(handler ControllerInterface, mws ...Middleware) {
+	controllerName := reflect.Indirect(reflect.ValueOf(handler)).Type().Name()
+	controllerMiddlewares[controllerName] = append(controllerMiddlewares[controllerName], mws...)
+	resetChainCache()
+}
+
+//getMiddlewares 执行顺序：全局、路由前缀(短的在前)、分组(父分组在前)、controller
+//每个pattern、controller和分组只生成一次，返回的切片不能修改，append会复制
+func getMiddlewares(pattern, controllerName string, g *RouterGroup) []Middleware {
+	key := chainKey{pattern, controllerName, g}
+	chainMu.RLock()
+	mws, ok := chainCache[key]
+	chainMu.RUnlock()
+	if ok {
+		return mws
+	}
+
+	mws = buildMiddlewares(pattern, controllerName, g)
+	mws = mws[:len(mws):len(mws)]
+	chainMu.Lock()
+	chainCache[key] = mws
+	chainMu.Unlock()
+
+	return mws
+}
+
+func buildMiddlewares(pattern, controllerName string, g *RouterGroup) (mws []Middleware) {
+	mws = append(mws, middlewares...)
+
+	segments := splitPath(pattern)
+	var keys []string
+	lens := make(map[string]int)
+	for key := range patternMiddlewares {
+		prefix := splitPath(key)
+		if hasPathPrefix(segments, prefix) {
+			keys = append(keys, key)
+			lens[key] = len(prefix)
+		}
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if lens[keys[i]] == lens[keys[j]] {
+			return keys[i] < keys[j]
+		}
+		return lens[keys[i]] < lens[keys[j]]
+	})
+	for _, key := range keys {
+		mws = append(mws, patternMiddlewares[key]...)
+	}
+
+	mws = append(mws, g.middlewares()...)
+
+	if controllerName != "" {
+		mws = append(mws, controllerMiddlewares[controllerName]...)
+	}
+
+	return
+}
+
+//runMiddlewares 执行中间件链，返回h是否执行完
+func runMiddlewares(httpCtx *HTTPContext, mws []Middleware, h ContextHandler) (done bool) {
+	next := ContextHandler(func(httpCtx *HTTPContext) {
+		h(httpCtx)
+		done = true
+	})
+	for i := len(mws) - 1; i >= 0; i-- {
+		next = mws[i](next)
+	}
+	next(httpCtx)
+
+	return
+}
+
+//RecoverMiddleware 捕获panic，调用controller的ServerError
+//controller的action里的panic由Router自己捕获，这里主要是其他中间件、HandlerFunc和grpc
+func RecoverMiddleware(next ContextHandler) ContextHandler {
+	return func(httpCtx *HTTPContext) {
+		defer func() {
+			if err := recover(); err != nil {
+				//用户触发的
+				if err == ErrStopRun {
+					return
+				}
+				httpCtx.recordPanic(err, common.GetStack())
+				httpCtx.serverError()
+			}
+		}()
+		next(httpCtx)
+	}
+}
+
+//MetricsMiddleware 记录请求数、错误数和耗时
+//请求结束、输出完成后才记录，以便获取实际输出的状态码
+func MetricsMiddleware(next ContextHandler) ContextHandler {
+	return func(httpCtx *HTTPContext) {
+		httpCtx.metricsStart = time.Now()
+		next(httpCtx)
+	}
+}
+
+//endRequest http请求结束的时候记录监控、访问日志和上报错误
+func (httpCtx *HTTPContext) endRequest(startTime time.Time) {
+	status := httpCtx.ResponseStatus()
+	httpCtx.recordMetrics(strconv.Itoa(status), status >= http.StatusInternalServerError)
+	httpCtx.writeAccessLog(startTime)
+	httpCtx.reportHTTPError(status)
+}
+
+//recordMetrics 经过MetricsMiddleware的请求才记录
+func (httpCtx *HTTPContext) recordMetrics(status string, isError bool) {
+	if httpCtx.metricsStart.IsZero() {
+		return
+	}
+	path, method := httpCtx.requestPath, httpCtx.requestMethod
+	costTime := time.Since(httpCtx.metricsStart)
+	//开启了访问日志的时候不再重复记录
+	if accessLogger == nil {
+		httpCtx.Mixf("Path:%s Method:%s Status:%s CostTime:%s", path, method, status, costTime)
+	}
+	prometheus.RequestsTotalWithStatus(path, method, status)
+	prometheus.RequestsCosttime(path, method, costTime)
+	if isError {
+		prometheus.RequestsErrors(path, method, status)
+	}
+}
+
+var online uint32
+
+//ConcurrenceMiddleware 根据Server.Concurrence限制http和grpc的总并发
+func ConcurrenceMiddleware(next ContextHandler) ContextHandler {
+	return func(httpCtx *HTTPContext) {
+		onlineNum := atomic.AddUint32(&online, 1)
+		defer atomic.AddUint32(&online, ^uint32(0))
+		if accessLogger != nil {
+			httpCtx.Debugf("Online:%d", onlineNum)
+		} else if httpCtx.Request != nil {
+			httpCtx.Mixf("From:%s Path:%s Online:%d", httpCtx.Request.RemoteAddr, httpCtx.Request.URL.String(), onlineNum)
+		} else {
+			httpCtx.Mixf("Online:%d", onlineNum)
+		}
+		err := checkConcurrence(onlineNum)
+		if err != nil {
+			httpCtx.Warn(err)
+			httpCtx.HTTPStatus = http.StatusServiceUnavailable
+			httpCtx.ErrNo = http.StatusServiceUnavailable
+			httpCtx.ErrMsg = err.Error()
+			return
+		}
+		next(httpCtx)
+	}
+}
+
+//Server.Concurrence，Reload的时候会修改
+var concurrence uint32
+
+func checkConcurrence(onlineNum uint32) (err error) {
+	max := atomic.LoadUint32(&concurrence)
+	if max == 0 {
+		return nil
+	}
+
+	if onlineNum > max {
+		return errors.New("checkConcurrence: too many concurrence")
+	}
+	return nil
+}
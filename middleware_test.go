@@ -0,0 +1,106 @@
+package hfw
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/hsyan2008/hfw/configs"
+)
+
+func TestRunMiddlewares(t *testing.T) {
+	var trace []string
+	mark := func(name string, isStop bool) Middleware {
+		return func(next ContextHandler) ContextHandler {
+			return func(httpCtx *HTTPContext) {
+				trace = append(trace, name)
+				if isStop {
+					return
+				}
+				next(httpCtx)
+			}
+		}
+	}
+
+	defer SetMiddlewares(middlewares...)
+	SetMiddlewares(mark("global", false))
+	UsePattern("/admin/user", mark("user", false))
+	UsePattern("/Admin", mark("admin", false))
+	UsePattern("/administrator", mark("administrator", false))
+	defer func() {
+		delete(patternMiddlewares, "admin")
+		delete(patternMiddlewares, "admin/user")
+		delete(patternMiddlewares, "administrator")
+		resetChainCache()
+	}()
+
+	done := runMiddlewares(&HTTPContext{}, getMiddlewares("admin/user/:id", "", nil), func(*HTTPContext) {
+		trace = append(trace, "handler")
+	})
+	if !done || strings.Join(trace, ",") != "global,admin,user,handler" {
+		t.Errorf("done: %v, trace: %v", done, trace)
+	}
+
+	trace = nil
+	mws := append(getMiddlewares("admin", "", nil), mark("stop", true))
+	done = runMiddlewares(&HTTPContext{}, mws, func(*HTTPContext) {
+		trace = append(trace, "handler")
+	})
+	if done || strings.Join(trace, ",") != "global,admin,stop" {
+		t.Errorf("done: %v, trace: %v", done, trace)
+	}
+
+	//注册后重新生成
+	trace = nil
+	UsePattern("/admin/user/:id", mark("id", false))
+	defer delete(patternMiddlewares, "admin/user/:id")
+	runMiddlewares(&HTTPContext{}, getMiddlewares("admin/user/:id", "", nil), func(*HTTPContext) {})
+	if strings.Join(trace, ",") != "global,admin,user,id" {
+		t.Errorf("trace: %v", trace)
+	}
+}
+
+func TestHandlerFuncPanicAfterWrite(t *testing.T) {
+	HandlerFunc("/test/panic_after_write", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("partial"))
+		panic("after write")
+	})
+	w := httptest.NewRecorder()
+	http.DefaultServeMux.ServeHTTP(w, httptest.NewRequest("GET", "/test/panic_after_write", nil))
+	if w.Body.String() != "partial" {
+		t.Errorf("body: %s", w.Body.String())
+	}
+}
+
+func TestSessionAfterShedding(t *testing.T) {
+	c := *configs.Get()
+	defer configs.Set(configs.Set(&c))
+	c.Session.IsEnable = true
+	SetSessionStore(memSessionStore{})
+	defer SetSessionStore(nil)
+
+	serve := func() *HTTPContext {
+		httpCtx := NewHTTPContext()
+		httpCtx.Request = httptest.NewRequest("GET", "/user", nil)
+		httpCtx.ResponseWriter = httptest.NewRecorder()
+		httpCtx.HTTPStatus = http.StatusOK
+		runMiddlewares(httpCtx, middlewares, func(*HTTPContext) {})
+		return httpCtx
+	}
+
+	//并发超过限制，拒绝的请求不创建session
+	atomic.StoreUint32(&concurrence, 1)
+	atomic.AddUint32(&online, 1)
+	httpCtx := serve()
+	atomic.AddUint32(&online, ^uint32(0))
+	atomic.StoreUint32(&concurrence, 0)
+	if httpCtx.HTTPStatus != http.StatusServiceUnavailable || httpCtx.Session != nil {
+		t.Errorf("rejected: %d %v", httpCtx.HTTPStatus, httpCtx.Session)
+	}
+
+	if httpCtx = serve(); httpCtx.Session == nil {
+		t.Error("session should be created")
+	}
+}
@@ -1,12 +1,15 @@
 package nosql
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"sync"
 	"time"
 
 	"github.com/globalsign/mgo"
+	"github.com/hsyan2008/hfw/health"
+	"github.com/hsyan2008/hfw/signal"
 )
 
 type Mongo struct {
@@ -17,6 +20,22 @@ type Mongo struct {
 var mongoSessions = make(map[string]*mgo.Session)
 var lock = new(sync.Mutex)
 
+func init() {
+	signal.OnShutdown("mongo", signal.PriorityClosePool, closeAll)
+}
+
+//closeAll 退出的时候关闭所有的session
+func closeAll(context.Context) error {
+	lock.Lock()
+	defer lock.Unlock()
+	for key, s := range mongoSessions {
+		s.Close()
+		delete(mongoSessions, key)
+	}
+
+	return nil
+}
+
 func NewMongo(address, dbName string) (m *Mongo, err error) {
 	if address == "" {
 		return nil, errors.New("nil address")
@@ -49,6 +68,10 @@ func NewMongo(address, dbName string) (m *Mongo, err error) {
 		}
 		mongoInstance.SetMode(mgo.Monotonic, true)
 		mongoSessions[key] = mongoInstance
+		session := mongoInstance
+		health.Register("mongo."+dbName, func(context.Context) error {
+			return session.Ping()
+		})
 	}
 
 	return &Mongo{
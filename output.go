@@ -1,12 +1,15 @@
 package hfw
 
 import (
-	"compress/gzip"
-	"html/template"
+	"bytes"
+	"fmt"
+	"hash/fnv"
 	"io"
+	"net/http"
 	"os"
 	"path/filepath"
-	"sync"
+	"strings"
+	"time"
 
 	"github.com/hsyan2008/hfw/common"
 	"github.com/hsyan2008/hfw/configs"
@@ -21,7 +24,7 @@ func (httpCtx *HTTPContext) RenderResponse() {
 	}
 	httpCtx.ResponseWriter.Header().Set("Trace-Id", httpCtx.GetTraceID())
 
-	if (configs.Config.EnableSession || configs.Config.Session.IsEnable) && httpCtx.Session != nil {
+	if c := configs.Get(); (c.EnableSession || c.Session.IsEnable) && httpCtx.Session != nil {
 		httpCtx.Session.Close(httpCtx.Request, httpCtx.ResponseWriter)
 	}
 
@@ -34,9 +37,16 @@ func (httpCtx *HTTPContext) RenderResponse() {
 		return
 	}
 
+	if httpCtx.renderErrorPage() {
+		return
+	}
+
 	if httpCtx.IsJSON {
 		httpCtx.ReturnJSON()
 		return
+	} else if httpCtx.MediaType != "" {
+		httpCtx.ReturnData(httpCtx.MediaType)
+		return
 	} else if httpCtx.TemplateFile != "" || httpCtx.Template != "" {
 		httpCtx.Render()
 		return
@@ -46,182 +56,125 @@ func (httpCtx *HTTPContext) RenderResponse() {
 }
 
 //ReturnFileContent 下载文件服务
+//file是文件路径的时候，返回Last-Modified和ETag，支持If-Modified-Since和If-None-Match
+//file是io.ReadSeeker(包括文件路径)的时候，支持Range请求，返回206或416
+//Range请求和图片、压缩包等类型不压缩，其他按协商的算法压缩
 func (httpCtx *HTTPContext) ReturnFileContent(contentType, filename string, file interface{}) {
 	httpCtx.IsJSON = false
 	httpCtx.Template = ""
 	httpCtx.TemplateFile = ""
-	var w io.Writer
 	var r io.Reader
 	var err error
-	if !httpCtx.IsError && httpCtx.IsZip {
-		httpCtx.ResponseWriter.Header().Del("Content-Length")
-		httpCtx.ResponseWriter.Header().Set("Content-Encoding", "gzip")
-		w = gzip.NewWriter(httpCtx.ResponseWriter)
-		defer w.(io.WriteCloser).Close()
-	} else {
-		w = httpCtx.ResponseWriter
-	}
+	var modTime time.Time
+	header := httpCtx.ResponseWriter.Header()
 
 	switch t := file.(type) {
 	case string: //文件路径，http.ServeFile不自动压缩
-		f, err := filepath.Abs(file.(string))
+		f, err := filepath.Abs(t)
 		httpCtx.ThrowCheck(500, err)
 		if !common.IsExist(f) {
 			httpCtx.ThrowCheck(500, "file not exist")
 		}
-		r, err = os.Open(t)
-		defer r.(io.Closer).Close()
+		fh, err := os.Open(f)
+		httpCtx.ThrowCheck(500, err)
+		defer fh.Close()
+		fi, err := fh.Stat()
 		httpCtx.ThrowCheck(500, err)
-	case io.Reader: //io流，如果是文件内容，可以通过bytes.Buffer包装下
-		r = file.(io.Reader)
-		if f, ok := file.(io.Closer); ok {
+		if fi.IsDir() {
+			httpCtx.ThrowCheck(500, "file is dir")
+		}
+		modTime = fi.ModTime()
+		header.Set("ETag", fmt.Sprintf(`"%x-%x"`, modTime.UnixNano(), fi.Size()))
+		r = fh
+	case io.Reader: //io流，如果是文件内容，可以通过bytes.Reader包装下以支持Range
+		r = t
+		if f, ok := t.(io.Closer); ok {
 			defer f.Close()
 		}
 	}
 
-	httpCtx.ResponseWriter.Header().Set("Content-Type", contentType)
+	header.Set("Content-Type", contentType)
 	httpCtx.SetDownloadMode(filename)
 
-	httpCtx.ResponseWriter.WriteHeader(httpCtx.HTTPStatus)
-
-	_, err = io.Copy(w, r)
-	// httpCtx.ThrowCheck(500, err)
-	if err != nil {
-		httpCtx.Warn(err)
+	rs, isSeeker := r.(io.ReadSeeker)
+	isZip := httpCtx.isCompress() && isCompressibleType(contentType)
+	if isSeeker && httpCtx.HTTPStatus == http.StatusOK &&
+		(!isZip || httpCtx.Request.Header.Get("Range") != "") {
+		//处理Range、If-Range和条件请求
+		http.ServeContent(httpCtx.ResponseWriter, httpCtx.Request, filename, modTime, rs)
+		return
 	}
-}
 
-var templatesCache = struct {
-	list map[string]*template.Template
-	l    *sync.RWMutex
-}{
-	list: make(map[string]*template.Template),
-	l:    &sync.RWMutex{},
-}
-
-//Render ..
-func (httpCtx *HTTPContext) Render() {
-	var (
-		t   *template.Template
-		err error
-	)
-	t = httpCtx.render()
-
-	if len(httpCtx.ResponseWriter.Header().Get("Content-Type")) == 0 {
-		httpCtx.ResponseWriter.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if isSeeker {
+		header.Set("Accept-Ranges", "bytes")
+	}
+	if !modTime.IsZero() {
+		header.Set("Last-Modified", modTime.UTC().Format(http.TimeFormat))
+	}
+	if httpCtx.HTTPStatus == http.StatusOK && httpCtx.isNotModified(header.Get("ETag"), modTime) {
+		header.Del("Content-Type")
+		httpCtx.ResponseWriter.WriteHeader(http.StatusNotModified)
+		return
 	}
 
-	var w io.Writer = httpCtx.ResponseWriter
-	if !httpCtx.IsError && httpCtx.IsZip {
-		httpCtx.ResponseWriter.Header().Del("Content-Length")
-		httpCtx.ResponseWriter.Header().Set("Content-Encoding", "gzip")
-		writer := gzip.NewWriter(httpCtx.ResponseWriter)
-		defer writer.Close()
-		w = writer
+	w := httpCtx.newCompressWriter()
+	_, err = io.Copy(w, r)
+	if e := w.Close(); err == nil {
+		err = e
 	}
-	httpCtx.ResponseWriter.WriteHeader(httpCtx.HTTPStatus)
-	err = t.Execute(w, httpCtx)
 	// httpCtx.ThrowCheck(500, err)
 	if err != nil {
 		httpCtx.Warn(err)
 	}
 }
 
-func (httpCtx *HTTPContext) render() (t *template.Template) {
-	var key string
-	var render func() *template.Template
-	var ok bool
-	if httpCtx.Template != "" {
-		key = httpCtx.Path
-		render = httpCtx.renderHTML
-	} else if httpCtx.TemplateFile != "" {
-		key = httpCtx.TemplateFile
-		render = httpCtx.renderFile
-	}
-
-	if Config.Template.IsCache {
-		templatesCache.l.RLock()
-		if t, ok = templatesCache.list[key]; !ok {
-			templatesCache.l.RUnlock()
-			// t = httpCtx.render()
-			t = render()
-			templatesCache.l.Lock()
-			templatesCache.list[key] = t
-			templatesCache.l.Unlock()
-		} else {
-			templatesCache.l.RUnlock()
-		}
-	} else {
-		// t = httpCtx.render()
-		t = render()
+//isNotModified 判断If-None-Match和If-Modified-Since，ETag使用弱比较
+//有If-None-Match的时候忽略If-Modified-Since
+func (httpCtx *HTTPContext) isNotModified(etag string, modTime time.Time) bool {
+	method := httpCtx.Request.Method
+	if method != http.MethodGet && method != http.MethodHead {
+		return false
 	}
 
-	return t
-}
-
-func (httpCtx *HTTPContext) renderHTML() (t *template.Template) {
-	if len(httpCtx.FuncMap) == 0 {
-		t = template.Must(template.New(httpCtx.Path).Parse(httpCtx.Template))
-	} else {
-		t = template.Must(template.New(httpCtx.Path).Funcs(httpCtx.FuncMap).Parse(httpCtx.Template))
-	}
-	if len(Config.Template.WidgetsPath) > 0 {
-		t = template.Must(t.ParseGlob(Config.Template.WidgetsPath))
+	if inm := httpCtx.Request.Header.Get("If-None-Match"); inm != "" {
+		if etag == "" {
+			return false
+		}
+		for _, v := range strings.Split(inm, ",") {
+			v = strings.TrimSpace(v)
+			if v == "*" || strings.TrimPrefix(v, "W/") == strings.TrimPrefix(etag, "W/") {
+				return true
+			}
+		}
+		return false
 	}
 
-	return
-}
-func (httpCtx *HTTPContext) renderFile() (t *template.Template) {
-	var templateFilePath string
-	if common.IsExist(httpCtx.TemplateFile) {
-		templateFilePath = httpCtx.TemplateFile
-	} else {
-		templateFilePath = filepath.Join(Config.Template.HTMLPath, httpCtx.TemplateFile)
+	if modTime.IsZero() || modTime.Equal(time.Unix(0, 0)) {
+		return false
 	}
-	if !common.IsExist(templateFilePath) {
-		httpCtx.ThrowCheck(500, "template path not exist")
-	}
-	if len(httpCtx.FuncMap) == 0 {
-		t = template.Must(template.ParseFiles(templateFilePath))
-	} else {
-		t = template.Must(template.New(filepath.Base(httpCtx.TemplateFile)).Funcs(httpCtx.FuncMap).ParseFiles(templateFilePath))
-	}
-	if len(Config.Template.WidgetsPath) > 0 {
-		t = template.Must(t.ParseGlob(Config.Template.WidgetsPath))
+	ims, err := http.ParseTime(httpCtx.Request.Header.Get("If-Modified-Since"))
+	if err != nil {
+		return false
 	}
 
-	return
+	return !modTime.Truncate(time.Second).After(ims)
 }
 
 //ReturnJSON ..
 func (httpCtx *HTTPContext) ReturnJSON() {
-	httpCtx.ResponseWriter.Header().Set("Content-Type", "application/json; charset=utf-8")
-	if len(httpCtx.Data) > 0 && httpCtx.Results == nil {
-		httpCtx.Results = httpCtx.Data
-	}
+	httpCtx.ReturnData(MIMEJSON)
+}
 
-	var w io.Writer
-	if !httpCtx.IsError && httpCtx.IsZip {
-		httpCtx.ResponseWriter.Header().Del("Content-Length")
-		httpCtx.ResponseWriter.Header().Set("Content-Encoding", "gzip")
-		w = gzip.NewWriter(httpCtx.ResponseWriter)
-		defer w.(io.WriteCloser).Close()
-	} else {
-		w = httpCtx.ResponseWriter
+//ReturnData 按mediaType对应的renderer输出数据，没有注册的时候输出json
+func (httpCtx *HTTPContext) ReturnData(mediaType string) {
+	r := GetRenderer(mediaType)
+	if r == nil {
+		r = GetRenderer(MIMEJSON)
 	}
+	httpCtx.ResponseWriter.Header().Set("Content-Type", r.ContentType())
 
 	var err error
-	var results interface{}
-	if httpCtx.IsOnlyResults {
-		//results
-		results = httpCtx.Results
-	} else if httpCtx.HasHeader {
-		//header + response(err_no + err_msg + results)
-		results = httpCtx
-	} else {
-		//response(err_no + err_msg + results)
-		results = httpCtx.Response
-	}
+	results := httpCtx.responseData()
 	httpCtx.Debugf("Response: %s", func() string {
 		var b []byte
 		b, err = encoding.JSON.Marshal(results)
@@ -230,10 +183,80 @@ func (httpCtx *HTTPContext) ReturnJSON() {
 		}
 		return string(b)
 	}())
-	httpCtx.ResponseWriter.WriteHeader(httpCtx.HTTPStatus)
-	err = encoding.JSONIO.Marshal(w, results)
+	err = httpCtx.writeBody(func(w io.Writer) error {
+		return r.Render(w, results)
+	})
 	// httpCtx.ThrowCheck(500, err)
 	if err != nil {
 		httpCtx.Warn(err)
 	}
 }
+
+//writeBody 输出状态码和render生成的body，处理ETag和压缩
+func (httpCtx *HTTPContext) writeBody(render func(w io.Writer) error) (err error) {
+	header := httpCtx.ResponseWriter.Header()
+	if httpCtx.isETagEnabled() {
+		buf := new(bytes.Buffer)
+		err = render(buf)
+		if err == nil {
+			h := fnv.New64a()
+			_, _ = h.Write(buf.Bytes())
+			etag := fmt.Sprintf(`W/"%x-%x"`, buf.Len(), h.Sum64())
+			header.Set("ETag", etag)
+			if httpCtx.isNotModified(etag, time.Time{}) {
+				header.Del("Content-Type")
+				httpCtx.ResponseWriter.WriteHeader(http.StatusNotModified)
+				return
+			}
+		}
+		//出错的时候，和不开启ETag一样输出已生成的内容
+		renderErr := err
+		render = func(w io.Writer) error {
+			if _, err := buf.WriteTo(w); err != nil {
+				return err
+			}
+			return renderErr
+		}
+	}
+
+	w := httpCtx.newCompressWriter()
+	err = render(w)
+	if e := w.Close(); err == nil {
+		err = e
+	}
+
+	return
+}
+
+//isETagEnabled 只对GET和HEAD的正常返回计算ETag
+func (httpCtx *HTTPContext) isETagEnabled() bool {
+	if !httpCtx.IsETag || httpCtx.IsError || httpCtx.HTTPStatus != http.StatusOK || httpCtx.Request == nil {
+		return false
+	}
+
+	return httpCtx.Request.Method == http.MethodGet || httpCtx.Request.Method == http.MethodHead
+}
+
+//SetCacheControl 设置Cache-Control，如SetCacheControl("public", "max-age=60")
+func (httpCtx *HTTPContext) SetCacheControl(directives ...string) {
+	httpCtx.ResponseWriter.Header().Set("Cache-Control", strings.Join(directives, ", "))
+}
+
+//SetMaxAge 允许客户端缓存maxAge，isPublic表示允许代理服务器缓存
+func (httpCtx *HTTPContext) SetMaxAge(maxAge time.Duration, isPublic bool) {
+	scope := "private"
+	if isPublic {
+		scope = "public"
+	}
+	httpCtx.SetCacheControl(scope, fmt.Sprintf("max-age=%d", int64(maxAge/time.Second)))
+}
+
+//SetNoCache 客户端每次都需要验证，一般和ETag一起使用
+func (httpCtx *HTTPContext) SetNoCache() {
+	httpCtx.SetCacheControl("no-cache")
+}
+
+//SetNoStore 禁止缓存
+func (httpCtx *HTTPContext) SetNoStore() {
+	httpCtx.SetCacheControl("no-store")
+}
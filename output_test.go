@@ -0,0 +1,102 @@
+package hfw
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestReturnFileContent(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "a.txt")
+	if err := os.WriteFile(file, []byte("0123456789"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	serve := func(isZip bool, header map[string]string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest("GET", "/download", nil)
+		for k, v := range header {
+			r.Header.Set(k, v)
+		}
+		w := httptest.NewRecorder()
+		httpCtx := &HTTPContext{ResponseWriter: w, Request: r, HTTPStatus: http.StatusOK, IsZip: isZip}
+		if isZip {
+			httpCtx.ContentEncoding = "gzip"
+		}
+		httpCtx.ReturnFileContent("text/plain", "a.txt", file)
+		return w
+	}
+
+	w := serve(false, map[string]string{"Range": "bytes=2-4"})
+	if w.Code != http.StatusPartialContent || w.Body.String() != "234" {
+		t.Errorf("range: %d %s", w.Code, w.Body.String())
+	}
+	etag := w.Header().Get("ETag")
+	if etag == "" || w.Header().Get("Last-Modified") == "" || w.Header().Get("Accept-Ranges") != "bytes" {
+		t.Errorf("error header: %v", w.Header())
+	}
+
+	w = serve(false, map[string]string{"Range": "bytes=20-"})
+	if w.Code != http.StatusRequestedRangeNotSatisfiable {
+		t.Errorf("range: %d", w.Code)
+	}
+
+	w = serve(true, map[string]string{"If-None-Match": etag})
+	if w.Code != http.StatusNotModified {
+		t.Errorf("if-none-match: %d", w.Code)
+	}
+
+	//小于MinLength不压缩
+	w = serve(true, nil)
+	if w.Code != http.StatusOK || w.Header().Get("Content-Encoding") != "" || w.Body.String() != "0123456789" {
+		t.Errorf("small: %d %v", w.Code, w.Header())
+	}
+
+	if err := os.WriteFile(file, bytes.Repeat([]byte("0123456789"), 200), 0644); err != nil {
+		t.Fatal(err)
+	}
+	w = serve(true, nil)
+	if w.Code != http.StatusOK || w.Header().Get("Content-Encoding") != "gzip" ||
+		!strings.HasPrefix(w.Header().Get("ETag"), "W/") {
+		t.Errorf("gzip: %d %v", w.Code, w.Header())
+	}
+}
+
+func TestReturnJSONETag(t *testing.T) {
+	serve := func(header map[string]string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest("GET", "/etag", nil)
+		for k, v := range header {
+			r.Header.Set(k, v)
+		}
+		w := httptest.NewRecorder()
+		httpCtx := NewHTTPContext()
+		httpCtx.ResponseWriter, httpCtx.Request = w, r
+		httpCtx.HTTPStatus, httpCtx.IsETag = http.StatusOK, true
+		httpCtx.Results = map[string]int{"a": 1}
+		httpCtx.SetNoCache()
+		httpCtx.ReturnJSON()
+		return w
+	}
+
+	w := serve(nil)
+	etag := w.Header().Get("ETag")
+	if w.Code != http.StatusOK || !strings.HasPrefix(etag, `W/"`) || w.Body.Len() == 0 {
+		t.Fatalf("first: %d %v", w.Code, w.Header())
+	}
+	if w.Header().Get("Cache-Control") != "no-cache" {
+		t.Errorf("cache-control: %s", w.Header().Get("Cache-Control"))
+	}
+
+	w = serve(map[string]string{"If-None-Match": etag})
+	if w.Code != http.StatusNotModified || w.Body.Len() != 0 {
+		t.Errorf("if-none-match: %d %s", w.Code, w.Body.String())
+	}
+
+	w = serve(map[string]string{"If-None-Match": `W/"other"`})
+	if w.Code != http.StatusOK || w.Header().Get("ETag") != etag {
+		t.Errorf("mismatch: %d %v", w.Code, w.Header())
+	}
+}
@@ -14,6 +14,10 @@ var (
 	conf             configs.PrometheusConfig
 	requestsTotal    *prometheus.CounterVec
 	requestsCosttime *prometheus.SummaryVec
+	requestsErrors   *prometheus.CounterVec
+	limitRejected    *prometheus.CounterVec
+	limitInflight    *prometheus.GaugeVec
+	limitAdaptive    *prometheus.GaugeVec
 	float64Duration  = float64(time.Millisecond)
 )
 
@@ -27,7 +31,7 @@ func Init(c configs.PrometheusConfig) {
 			Name: c.RequestsTotal,
 			Help: strings.ReplaceAll(c.RequestsTotal, "_", " "),
 		},
-		[]string{"app", "host", "path", "method"},
+		[]string{"app", "host", "path", "method", "status"},
 	)
 	requestsCosttime = promauto.NewSummaryVec(
 		prometheus.SummaryOpts{
@@ -38,16 +42,51 @@ func Init(c configs.PrometheusConfig) {
 		},
 		[]string{"app", "host", "path", "method"},
 	)
+	requestsErrors = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: c.RequestsErrors,
+			Help: strings.ReplaceAll(c.RequestsErrors, "_", " "),
+		},
+		[]string{"app", "host", "path", "method", "status"},
+	)
+	limitRejected = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: c.LimitRejected,
+			Help: strings.ReplaceAll(c.LimitRejected, "_", " "),
+		},
+		[]string{"app", "host", "path", "method", "rule", "reason"},
+	)
+	limitInflight = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: c.LimitInflight,
+			Help: strings.ReplaceAll(c.LimitInflight, "_", " "),
+		},
+		[]string{"app", "host", "rule"},
+	)
+	limitAdaptive = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: c.LimitAdaptive,
+			Help: strings.ReplaceAll(c.LimitAdaptive, "_", " "),
+		},
+		[]string{"app", "host", "type"},
+	)
 }
 
+//RequestsTotal 请求数，兼容原来的调用，status为空，请使用RequestsTotalWithStatus
 func RequestsTotal(path, method string) {
+	RequestsTotalWithStatus(path, method, "")
+}
+
+//RequestsTotalWithStatus 请求数，status是实际输出的状态码，grpc是code的名称
+func RequestsTotalWithStatus(path, method, status string) {
 	if conf.IsEnable == false {
 		return
 	}
 	requestsTotal.WithLabelValues(common.GetAppName(),
 		common.GetHostName(),
 		path,
-		method).Inc()
+		method,
+		status).Inc()
 }
 
 func RequestsCosttime(path, method string, duration time.Duration) {
@@ -59,3 +98,48 @@ func RequestsCosttime(path, method string, duration time.Duration) {
 		path,
 		method).Observe(float64(duration) / float64Duration)
 }
+
+//RequestsErrors 服务端错误的请求数，http是5xx，grpc是对应5xx的code
+func RequestsErrors(path, method, status string) {
+	if conf.IsEnable == false {
+		return
+	}
+	requestsErrors.WithLabelValues(common.GetAppName(),
+		common.GetHostName(),
+		path,
+		method,
+		status).Inc()
+}
+
+//LimitRejected 被限流拒绝的请求，reason是rate或concurrence
+func LimitRejected(path, method, rule, reason string) {
+	if conf.IsEnable == false {
+		return
+	}
+	limitRejected.WithLabelValues(common.GetAppName(),
+		common.GetHostName(),
+		path,
+		method,
+		rule,
+		reason).Inc()
+}
+
+//LimitInflight 限流规则当前的并发数
+func LimitInflight(rule string, delta float64) {
+	if conf.IsEnable == false {
+		return
+	}
+	limitInflight.WithLabelValues(common.GetAppName(),
+		common.GetHostName(),
+		rule).Add(delta)
+}
+
+//LimitAdaptive 自适应限流的状态，typ是limit、rtt_short、rtt_long、cpu
+func LimitAdaptive(typ string, value float64) {
+	if conf.IsEnable == false {
+		return
+	}
+	limitAdaptive.WithLabelValues(common.GetAppName(),
+		common.GetHostName(),
+		typ).Set(value)
+}
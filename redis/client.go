@@ -1,11 +1,17 @@
 package redis
 
 import (
+	"context"
 	"errors"
 	"fmt"
+	"strconv"
+	"strings"
 
 	"github.com/hsyan2008/hfw/configs"
+	"github.com/hsyan2008/hfw/tracing"
 	radix "github.com/mediocregopher/radix/v3"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
 type Client struct {
@@ -17,18 +23,67 @@ type Client struct {
 	Marshal func(interface{}) ([]byte, error)
 	//不管以下属性是否nil，MGet的结果都需要自行处理
 	Unmarshal func([]byte, interface{}) error
+
+	//用于链路追踪，ctx里有span的时候给每个命令创建子span
+	ctx context.Context
 }
 
 func New(redisConfig configs.RedisConfig) (c *Client, err error) {
 	return newClient(redisConfig)
 }
 
+//IsInit 是否可用，没有配置Redis的时候DefaultIns不是nil，但是没有连接
+func (c *Client) IsInit() bool {
+	return c != nil && c.client != nil
+}
+
 func (c *Client) Do(a radix.Action) error {
 	if c == nil || c.client == nil {
 		return errors.New("redis instance not init")
 	}
 
-	return c.client.Do(a)
+	if c.ctx == nil || !trace.SpanContextFromContext(c.ctx).IsValid() {
+		return c.client.Do(a)
+	}
+
+	cmd := cmdName(a)
+	_, span := tracing.StartChild(c.ctx, strings.TrimSpace("redis "+cmd), trace.SpanKindClient,
+		attribute.String("db.system", "redis"),
+		attribute.String("db.operation", cmd),
+	)
+	err := c.client.Do(a)
+	tracing.End(span, err)
+
+	return err
+}
+
+//WithContext 返回使用ctx的Client，如redis.DefaultIns.WithContext(httpCtx).Get(...)
+func (c *Client) WithContext(ctx context.Context) *Client {
+	if c == nil {
+		return c
+	}
+	client := *c
+	client.ctx = ctx
+
+	return &client
+}
+
+//cmdName 从radix.Cmd的String，如["SET" "key" "value"]里获取命令名
+func cmdName(a radix.Action) string {
+	s, ok := a.(fmt.Stringer)
+	if !ok {
+		return ""
+	}
+	str := strings.TrimPrefix(s.String(), "[")
+	if i := strings.IndexAny(str, " ]"); i > 0 {
+		str = str[:i]
+	}
+	name, err := strconv.Unquote(str)
+	if err != nil {
+		return ""
+	}
+
+	return strings.ToUpper(name)
 }
 
 func (c *Client) Close() error {
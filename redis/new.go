@@ -1,12 +1,16 @@
 package redis
 
 import (
+	"context"
 	"errors"
 	"sync"
+	"sync/atomic"
 	"time"
 
+	logger "github.com/hsyan2008/go-logger"
 	"github.com/hsyan2008/hfw/configs"
 	"github.com/hsyan2008/hfw/encoding"
+	"github.com/hsyan2008/hfw/signal"
 	radix "github.com/mediocregopher/radix/v3"
 )
 
@@ -18,6 +22,27 @@ var OK = "OK"
 var insMap = make(map[string]radix.Client)
 var l = new(sync.Mutex)
 
+//ResetDrainDelay Reset后等待这么久再关闭原来的连接池，让正在执行的命令完成
+var ResetDrainDelay = 10 * time.Second
+
+func init() {
+	signal.OnShutdown("redis", signal.PriorityClosePool, closeAll)
+}
+
+//closeAll 退出的时候关闭所有的连接池
+func closeAll(context.Context) (err error) {
+	l.Lock()
+	defer l.Unlock()
+	for key, client := range insMap {
+		if e := client.Close(); e != nil {
+			err = e
+		}
+		delete(insMap, key)
+	}
+
+	return
+}
+
 func newClient(redisConfig configs.RedisConfig) (c *Client, err error) {
 	if len(redisConfig.Addresses) == 0 {
 		return c, errors.New("err redis config")
@@ -43,6 +68,18 @@ func newClient(redisConfig configs.RedisConfig) (c *Client, err error) {
 		return c, nil
 	}
 
+	pool, err := newPool(redisConfig)
+	if err != nil {
+		return
+	}
+	c.client = newSwapClient(pool)
+
+	insMap[key] = c.client
+
+	return
+}
+
+func newPool(redisConfig configs.RedisConfig) (radix.Client, error) {
 	if redisConfig.PoolSize <= 0 {
 		redisConfig.PoolSize = 10
 	}
@@ -59,20 +96,84 @@ func newClient(redisConfig configs.RedisConfig) (c *Client, err error) {
 		clusterFunc := func(network, addr string) (radix.Client, error) {
 			return radix.NewPool(network, addr, redisConfig.PoolSize, radix.PoolConnFunc(customConnFunc))
 		}
-		c.client, err = radix.NewCluster(redisConfig.Addresses, radix.ClusterPoolFunc(clusterFunc))
-	} else {
-		c.client, err = radix.NewPool("tcp", redisConfig.Addresses[0], redisConfig.PoolSize, radix.PoolConnFunc(customConnFunc))
+		return radix.NewCluster(redisConfig.Addresses, radix.ClusterPoolFunc(clusterFunc))
+	}
+
+	return radix.NewPool("tcp", redisConfig.Addresses[0], redisConfig.PoolSize, radix.PoolConnFunc(customConnFunc))
+}
+
+//Reset 按新的配置重建连接池，替换后等待ResetDrainDelay再关闭原来的连接池，WithContext返回的和共用连接池的Client也会生效
+//Prefix不会修改，需要重启
+func (c *Client) Reset(redisConfig configs.RedisConfig) (err error) {
+	if len(redisConfig.Addresses) == 0 {
+		return errors.New("err redis config")
 	}
+	sc, ok := c.client.(*swapClient)
+	if !ok {
+		return errors.New("redis instance not init")
+	}
+	key, err := encoding.JSON.MarshalToString(redisConfig)
 	if err != nil {
-		c.client = nil
 		return
 	}
 
-	insMap[key] = c.client
+	pool, err := newPool(redisConfig)
+	if err != nil {
+		return
+	}
+
+	l.Lock()
+	for k, v := range insMap {
+		if v == radix.Client(sc) {
+			delete(insMap, k)
+		}
+	}
+	insMap[key] = sc
+	old := sc.swap(pool)
+	l.Unlock()
+
+	//替换前取到连接池的命令还在使用原来的连接
+	time.AfterFunc(ResetDrainDelay, func() {
+		if err := old.Close(); err != nil {
+			logger.Warn("close old redis pool:", err)
+		}
+	})
 
 	return
 }
 
+//swapClient 可以替换连接池的radix.Client
+type swapClient struct {
+	v atomic.Value
+}
+
+//clientHolder atomic.Value要求类型一致，Pool和Cluster包一层
+type clientHolder struct {
+	radix.Client
+}
+
+func newSwapClient(client radix.Client) *swapClient {
+	sc := new(swapClient)
+	sc.v.Store(clientHolder{client})
+
+	return sc
+}
+
+func (sc *swapClient) swap(client radix.Client) radix.Client {
+	old := sc.v.Load().(clientHolder).Client
+	sc.v.Store(clientHolder{client})
+
+	return old
+}
+
+func (sc *swapClient) Do(a radix.Action) error {
+	return sc.v.Load().(clientHolder).Do(a)
+}
+
+func (sc *swapClient) Close() error {
+	return sc.v.Load().(clientHolder).Close()
+}
+
 //不能Close，会影响之前的连接
 func Clone(src ...*Client) (dst *Client, err error) {
 	c := DefaultIns
@@ -93,18 +194,19 @@ func closeClient(ins *Client) (err error) {
 		return nil
 	}
 
-	key, err := encoding.JSON.MarshalToString(ins.config)
-	if err != nil {
-		return
-	}
-
-	_ = ins.client.Close()
+	client := ins.client
+	_ = client.Close()
 	ins.client = nil
 	ins = nil
 
+	//Reset后key和config可能不一致，按连接池删除
 	l.Lock()
 	defer l.Unlock()
-	delete(insMap, key)
+	for key, v := range insMap {
+		if v == client {
+			delete(insMap, key)
+		}
+	}
 
 	return
 }
@@ -0,0 +1,107 @@
+package hfw
+
+import (
+	"crypto/subtle"
+	"net"
+	"net/http"
+	"strings"
+	"sync/atomic"
+
+	logger "github.com/hsyan2008/go-logger"
+	"github.com/hsyan2008/hfw/configs"
+	"github.com/hsyan2008/hfw/redis"
+	"github.com/hsyan2008/hfw/signal"
+)
+
+//initReload 订阅配置的变化，按Reload的配置开启文件检查和管理接口
+//Config和configs.Config是启动时的配置，不会修改，其他配置如Custom请使用configs.Get()读取，或者configs.Subscribe订阅
+func initReload(c configs.ReloadConfig) {
+	atomic.StoreUint32(&concurrence, uint32(Config.Server.Concurrence))
+
+	configs.Subscribe("Logger", func(old, new *configs.AllConfig) {
+		err := setLogger(new.Logger)
+		if err == nil {
+			err = reloadAccessLog(new.Logger)
+		}
+		if err != nil {
+			logger.Warn("reload logger:", err)
+		}
+	})
+	configs.Subscribe("Server.Concurrence", func(old, new *configs.AllConfig) {
+		atomic.StoreUint32(&concurrence, uint32(new.Server.Concurrence))
+	})
+	configs.Subscribe("Limit.Rules", func(old, new *configs.AllConfig) {
+		SetLimitRules(new.Limit.Rules)
+	})
+	configs.Subscribe("Limit.TrustedProxies", func(old, new *configs.AllConfig) {
+		if err := SetTrustedProxies(new.Limit.TrustedProxies); err != nil {
+			logger.Warn("reload trusted proxies:", err)
+		}
+	})
+	configs.Subscribe("Template", func(old, new *configs.AllConfig) {
+		//按新的路径重新检查
+		stopTemplateWatch()
+		clearTemplatesCache()
+	})
+	configs.Subscribe("Redis", func(old, new *configs.AllConfig) {
+		//启动时没有配置redis的，需要重启
+		if !redis.DefaultIns.IsInit() || !isRedisConnChanged(old.Redis, new.Redis) {
+			return
+		}
+		if err := redis.DefaultIns.Reset(new.Redis); err != nil {
+			logger.Warn("reload redis:", err)
+		}
+	})
+
+	if c.WatchInterval > 0 {
+		go configs.Watch(signal.GetSignalContext().Ctx, c.WatchInterval)
+	}
+
+	//不经过中间件，和健康检查一样
+	if c.AdminPath != "" {
+		http.HandleFunc(c.AdminPath, func(w http.ResponseWriter, r *http.Request) {
+			reloadHandler(w, r, c.Token)
+		})
+	}
+}
+
+//isRedisConnChanged 只有连接相关的配置修改了才重建连接池，Prefix等不需要
+func isRedisConnChanged(old, new configs.RedisConfig) bool {
+	return old.IsCluster != new.IsCluster || old.PoolSize != new.PoolSize ||
+		old.Db != new.Db || old.Password != new.Password ||
+		strings.Join(old.Addresses, ",") != strings.Join(new.Addresses, ",")
+}
+
+//reloadHandler token为空的时候只允许本机访问，否则校验Authorization: Bearer token
+func reloadHandler(w http.ResponseWriter, r *http.Request, token string) {
+	if !isReloadAllowed(r, token) {
+		http.Error(w, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+		return
+	}
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+	if err := configs.Reload(); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	_, _ = w.Write([]byte("ok"))
+}
+
+func isReloadAllowed(r *http.Request, token string) bool {
+	if token != "" {
+		auth := r.Header.Get("Authorization")
+		return strings.HasPrefix(auth, "Bearer ") &&
+			subtle.ConstantTimeCompare([]byte(strings.TrimPrefix(auth, "Bearer ")), []byte(token)) == 1
+	}
+
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	ip := net.ParseIP(host)
+
+	return ip != nil && ip.IsLoopback()
+}
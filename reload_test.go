@@ -0,0 +1,57 @@
+package hfw
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/hsyan2008/hfw/configs"
+)
+
+func TestReloadHandler(t *testing.T) {
+	for _, v := range []struct {
+		remoteAddr string
+		auth       string
+		token      string
+		code       int
+	}{
+		{"10.0.0.1:1234", "", "", http.StatusForbidden},
+		{"127.0.0.1:1234", "", "", http.StatusMethodNotAllowed},
+		{"[::1]:1234", "", "", http.StatusMethodNotAllowed},
+		//设置了token以后本机也需要校验
+		{"127.0.0.1:1234", "", "secret", http.StatusForbidden},
+		{"10.0.0.1:1234", "Bearer wrong", "secret", http.StatusForbidden},
+		{"10.0.0.1:1234", "Bearer secret", "secret", http.StatusMethodNotAllowed},
+	} {
+		r := httptest.NewRequest("GET", "/reload", nil)
+		r.RemoteAddr = v.remoteAddr
+		if v.auth != "" {
+			r.Header.Set("Authorization", v.auth)
+		}
+		w := httptest.NewRecorder()
+		reloadHandler(w, r, v.token)
+		if w.Code != v.code {
+			t.Errorf("%+v: %d", v, w.Code)
+		}
+	}
+}
+
+func TestIsRedisConnChanged(t *testing.T) {
+	old := configs.RedisConfig{Addresses: []string{"127.0.0.1:6379"}, Prefix: "a_", PoolSize: 10}
+	for _, v := range []struct {
+		f       func(c *configs.RedisConfig)
+		changed bool
+	}{
+		{func(c *configs.RedisConfig) { c.Prefix = "b_" }, false},
+		{func(c *configs.RedisConfig) { c.Expiration = 60 }, false},
+		{func(c *configs.RedisConfig) { c.Addresses = []string{"127.0.0.1:6380"} }, true},
+		{func(c *configs.RedisConfig) { c.PoolSize = 20 }, true},
+		{func(c *configs.RedisConfig) { c.Password = "secret" }, true},
+	} {
+		c := old
+		v.f(&c)
+		if isRedisConnChanged(old, c) != v.changed {
+			t.Errorf("%+v: %v", c, !v.changed)
+		}
+	}
+}
@@ -0,0 +1,325 @@
+package hfw
+
+import (
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/hsyan2008/hfw/common"
+	"github.com/hsyan2008/hfw/encoding"
+	"github.com/vmihailenco/msgpack/v5"
+	"google.golang.org/protobuf/encoding/protowire"
+	"google.golang.org/protobuf/proto"
+)
+
+//Renderer 按某种格式输出数据
+//v根据IsOnlyResults和HasHeader，分别是Results、*HTTPContext、common.Response
+type Renderer interface {
+	//返回的Content-Type
+	ContentType() string
+	Render(w io.Writer, v interface{}) error
+}
+
+const (
+	MIMEJSON     = "application/json"
+	MIMEXML      = "application/xml"
+	MIMEXML2     = "text/xml"
+	MIMEMsgPack  = "application/x-msgpack"
+	MIMEMsgPack2 = "application/msgpack"
+	MIMEProtobuf = "application/x-protobuf"
+	MIMEHTML     = "text/html"
+)
+
+var (
+	//key是media type
+	renderers = make(map[string]Renderer)
+	//key是format参数，value是media type
+	renderFormats = make(map[string]string)
+)
+
+func init() {
+	RegisterRenderer("json", jsonRenderer{}, MIMEJSON)
+	RegisterRenderer("xml", xmlRenderer{}, MIMEXML, MIMEXML2)
+	RegisterRenderer("msgpack", msgpackRenderer{}, MIMEMsgPack, MIMEMsgPack2)
+	RegisterRenderer("protobuf", protobufRenderer{}, MIMEProtobuf)
+}
+
+//RegisterRenderer 注册renderer，format用于url上的format参数，mediaTypes用于Accept
+//第一个mediaType是format对应的类型，重复注册会覆盖
+func RegisterRenderer(format string, r Renderer, mediaTypes ...string) {
+	if len(mediaTypes) == 0 {
+		panic("RegisterRenderer: nil mediaTypes for " + format)
+	}
+	for _, mediaType := range mediaTypes {
+		renderers[strings.ToLower(mediaType)] = r
+	}
+	if format != "" {
+		renderFormats[strings.ToLower(format)] = strings.ToLower(mediaTypes[0])
+	}
+}
+
+//GetRenderer 根据media type获取renderer
+func GetRenderer(mediaType string) Renderer {
+	return renderers[strings.ToLower(mediaType)]
+}
+
+//negotiateMediaType 优先format参数，然后按Accept的q值选择
+//返回空表示使用默认的输出方式(有模板渲染模板，否则json)
+func negotiateMediaType(format, accept string) string {
+	if format != "" {
+		return renderFormats[strings.ToLower(format)]
+	}
+	if accept == "" {
+		return ""
+	}
+
+	var (
+		mediaType string
+		maxQ      float64
+	)
+	for _, item := range strings.Split(accept, ",") {
+		t, params, err := mime.ParseMediaType(strings.TrimSpace(item))
+		if err != nil {
+			continue
+		}
+		q := 1.0
+		if v, ok := params["q"]; ok {
+			q, err = strconv.ParseFloat(v, 64)
+			if err != nil {
+				continue
+			}
+		}
+		//q相同的时候，取前面的
+		if q <= maxQ {
+			continue
+		}
+		switch {
+		case t == MIMEHTML || strings.HasSuffix(t, "/*"):
+			mediaType, maxQ = "", q
+		case renderers[t] != nil:
+			mediaType, maxQ = t, q
+		}
+	}
+
+	return mediaType
+}
+
+//responseData 根据IsOnlyResults和HasHeader返回需要输出的数据
+func (httpCtx *HTTPContext) responseData() interface{} {
+	if len(httpCtx.Data) > 0 && httpCtx.Results == nil {
+		httpCtx.Results = httpCtx.Data
+	}
+	if httpCtx.IsOnlyResults {
+		//results
+		return httpCtx.Results
+	} else if httpCtx.HasHeader {
+		//header + response(err_no + err_msg + results)
+		return httpCtx
+	}
+	//response(err_no + err_msg + results)
+	return httpCtx.Response
+}
+
+type jsonRenderer struct{}
+
+func (jsonRenderer) ContentType() string {
+	return "application/json; charset=utf-8"
+}
+
+func (jsonRenderer) Render(w io.Writer, v interface{}) error {
+	return encoding.JSONIO.Marshal(w, v)
+}
+
+type msgpackRenderer struct{}
+
+func (msgpackRenderer) ContentType() string {
+	return MIMEMsgPack
+}
+
+//字段名和json一致
+func (msgpackRenderer) Render(w io.Writer, v interface{}) error {
+	enc := msgpack.NewEncoder(w)
+	enc.SetCustomStructTag("json")
+	return enc.Encode(v)
+}
+
+type xmlRenderer struct{}
+
+func (xmlRenderer) ContentType() string {
+	return "application/xml; charset=utf-8"
+}
+
+//根节点分别是results、context、response，字段名和json一致
+//map按key排序输出，切片的每个元素是item节点
+func (xmlRenderer) Render(w io.Writer, v interface{}) error {
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	var err error
+	switch t := v.(type) {
+	case *HTTPContext:
+		err = enc.Encode(struct {
+			XMLName  xml.Name    `xml:"context"`
+			Response xmlResponse `xml:"response"`
+			Header   xmlValue    `xml:"header"`
+		}{Response: newXMLResponse(t.Response), Header: xmlValue{t.Header}})
+	case common.Response:
+		err = enc.Encode(newXMLResponse(t))
+	default:
+		err = enc.EncodeElement(xmlValue{t}, xml.StartElement{Name: xml.Name{Local: "results"}})
+	}
+	if err != nil {
+		return err
+	}
+
+	return enc.Flush()
+}
+
+type xmlResponse struct {
+	XMLName xml.Name `xml:"response"`
+	ErrNo   int64    `xml:"err_no"`
+	ErrMsg  string   `xml:"err_msg"`
+	Results xmlValue `xml:"results"`
+}
+
+func newXMLResponse(r common.Response) xmlResponse {
+	return xmlResponse{ErrNo: r.ErrNo, ErrMsg: r.ErrMsg, Results: xmlValue{r.Results}}
+}
+
+//xmlValue encoding/xml不支持map，这里处理map和切片，其他的交给encoding/xml
+type xmlValue struct {
+	v interface{}
+}
+
+func (x xmlValue) MarshalXML(e *xml.Encoder, start xml.StartElement) error {
+	if x.v == nil {
+		return e.EncodeElement("", start)
+	}
+	rv := reflect.ValueOf(x.v)
+	for rv.Kind() == reflect.Ptr || rv.Kind() == reflect.Interface {
+		if rv.IsNil() {
+			return e.EncodeElement("", start)
+		}
+		rv = rv.Elem()
+	}
+
+	switch rv.Kind() {
+	case reflect.Map:
+		if err := e.EncodeToken(start); err != nil {
+			return err
+		}
+		keys := rv.MapKeys()
+		sort.Slice(keys, func(i, j int) bool {
+			return fmt.Sprint(keys[i].Interface()) < fmt.Sprint(keys[j].Interface())
+		})
+		for _, key := range keys {
+			name := xml.StartElement{Name: xml.Name{Local: fmt.Sprint(key.Interface())}}
+			if err := e.EncodeElement(xmlValue{rv.MapIndex(key).Interface()}, name); err != nil {
+				return err
+			}
+		}
+		return e.EncodeToken(start.End())
+	case reflect.Slice, reflect.Array:
+		if rv.Type().Elem().Kind() == reflect.Uint8 {
+			break
+		}
+		//外层节点，里面每个元素是item
+		if err := e.EncodeToken(start); err != nil {
+			return err
+		}
+		item := xml.StartElement{Name: xml.Name{Local: "item"}}
+		for i := 0; i < rv.Len(); i++ {
+			if err := e.EncodeElement(xmlValue{rv.Index(i).Interface()}, item); err != nil {
+				return err
+			}
+		}
+		return e.EncodeToken(start.End())
+	}
+
+	return e.EncodeElement(rv.Interface(), start)
+}
+
+type protobufRenderer struct{}
+
+func (protobufRenderer) ContentType() string {
+	return MIMEProtobuf
+}
+
+//IsOnlyResults的时候，Results必须是proto.Message
+//否则按以下结构编码，results是Results的proto编码，可以直接定义成对应的message
+//message Response { int64 err_no = 1; string err_msg = 2; bytes results = 3; }
+//HasHeader的时候，外层是
+//message Context { Response response = 1; bytes header = 2; }
+func (protobufRenderer) Render(w io.Writer, v interface{}) (err error) {
+	var b []byte
+	switch t := v.(type) {
+	case *HTTPContext:
+		var resp, header []byte
+		resp, err = marshalProtobufResponse(t.Response)
+		if err != nil {
+			return
+		}
+		header, err = marshalProtobuf(t.Header)
+		if err != nil {
+			return
+		}
+		b = protowire.AppendTag(b, 1, protowire.BytesType)
+		b = protowire.AppendBytes(b, resp)
+		if len(header) > 0 {
+			b = protowire.AppendTag(b, 2, protowire.BytesType)
+			b = protowire.AppendBytes(b, header)
+		}
+	case common.Response:
+		b, err = marshalProtobufResponse(t)
+	default:
+		b, err = marshalProtobuf(t)
+	}
+	if err != nil {
+		return
+	}
+	_, err = w.Write(b)
+
+	return
+}
+
+func marshalProtobufResponse(r common.Response) (b []byte, err error) {
+	results, err := marshalProtobuf(r.Results)
+	if err != nil {
+		return
+	}
+	if r.ErrNo != 0 {
+		b = protowire.AppendTag(b, 1, protowire.VarintType)
+		b = protowire.AppendVarint(b, uint64(r.ErrNo))
+	}
+	if r.ErrMsg != "" {
+		b = protowire.AppendTag(b, 2, protowire.BytesType)
+		b = protowire.AppendString(b, r.ErrMsg)
+	}
+	if len(results) > 0 {
+		b = protowire.AppendTag(b, 3, protowire.BytesType)
+		b = protowire.AppendBytes(b, results)
+	}
+
+	return
+}
+
+var ErrNotProtoMessage = errors.New("protobuf render: data is not proto.Message")
+
+func marshalProtobuf(v interface{}) ([]byte, error) {
+	if v == nil {
+		return nil, nil
+	}
+	m, ok := v.(proto.Message)
+	if !ok {
+		return nil, ErrNotProtoMessage
+	}
+
+	return proto.Marshal(m)
+}
@@ -0,0 +1,45 @@
+package hfw
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/hsyan2008/hfw/common"
+)
+
+func TestNegotiateMediaType(t *testing.T) {
+	cases := []struct {
+		format, accept, mediaType string
+	}{
+		{"xml", "application/json", MIMEXML},
+		{"", "", ""},
+		{"", "application/json, text/plain, */*", MIMEJSON},
+		{"", "text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8", ""},
+		{"", "application/json;q=0.5, application/x-msgpack", MIMEMsgPack},
+		{"", "application/xml;q=0.8, application/x-protobuf;q=0.9", MIMEProtobuf},
+		{"", "image/png", ""},
+	}
+	for _, c := range cases {
+		if m := negotiateMediaType(c.format, c.accept); m != c.mediaType {
+			t.Errorf("format:%s accept:%s got %s, want %s", c.format, c.accept, m, c.mediaType)
+		}
+	}
+}
+
+func TestXMLRenderer(t *testing.T) {
+	buf := new(bytes.Buffer)
+	err := xmlRenderer{}.Render(buf, common.Response{
+		ErrNo:   1,
+		ErrMsg:  "msg",
+		Results: map[string]interface{}{"b": []int{1, 2}, "a": "x"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "<response><err_no>1</err_no><err_msg>msg</err_msg>" +
+		"<results><a>x</a><b><item>1</item><item>2</item></b></results></response>"
+	if !strings.HasSuffix(buf.String(), want) {
+		t.Errorf("got %s", buf.String())
+	}
+}
@@ -0,0 +1,109 @@
+package hfw
+
+import (
+	"bufio"
+	"errors"
+	"net"
+	"net/http"
+	"time"
+)
+
+//responseWriter 记录实际输出的状态码、字节数和首字节时间，用于监控和访问日志
+//controller、HandlerFunc、重定向和Hijack都经过这里
+type responseWriter struct {
+	http.ResponseWriter
+	status    int
+	size      int64
+	firstByte time.Time
+}
+
+func newResponseWriter(w http.ResponseWriter) *responseWriter {
+	if rw, ok := w.(*responseWriter); ok {
+		return rw
+	}
+
+	return &responseWriter{ResponseWriter: w}
+}
+
+func (w *responseWriter) WriteHeader(code int) {
+	//1xx不是最终的状态码
+	if w.status == 0 && code >= http.StatusOK {
+		w.status = code
+		w.firstByte = time.Now()
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *responseWriter) Write(b []byte) (n int, err error) {
+	w.written()
+	n, err = w.ResponseWriter.Write(b)
+	w.size += int64(n)
+
+	return
+}
+
+func (w *responseWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		w.written()
+		f.Flush()
+	}
+}
+
+//written 没有调用WriteHeader就输出的时候是200
+func (w *responseWriter) written() {
+	if w.status == 0 {
+		w.status = http.StatusOK
+		w.firstByte = time.Now()
+	}
+}
+
+func (w *responseWriter) Push(target string, opts *http.PushOptions) error {
+	if p, ok := w.ResponseWriter.(http.Pusher); ok {
+		return p.Push(target, opts)
+	}
+
+	return http.ErrNotSupported
+}
+
+func (w *responseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hj, ok := w.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("ResponseWriter does not implement http.Hijacker")
+	}
+	conn, bufrw, err := hj.Hijack()
+	if err == nil && w.status == 0 {
+		w.status = http.StatusSwitchingProtocols
+		w.firstByte = time.Now()
+	}
+
+	return conn, bufrw, err
+}
+
+//Unwrap 用于http.ResponseController
+func (w *responseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+//isResponseWritten 是否已经输出了header
+func (httpCtx *HTTPContext) isResponseWritten() bool {
+	w, ok := httpCtx.ResponseWriter.(*responseWriter)
+	return ok && w.status > 0
+}
+
+//ResponseStatus 实际输出的状态码，还没有输出的时候返回HTTPStatus
+func (httpCtx *HTTPContext) ResponseStatus() int {
+	if w, ok := httpCtx.ResponseWriter.(*responseWriter); ok && w.status > 0 {
+		return w.status
+	}
+
+	return httpCtx.HTTPStatus
+}
+
+//ResponseSize 实际输出的body字节数，压缩的时候是压缩后的大小
+func (httpCtx *HTTPContext) ResponseSize() int64 {
+	if w, ok := httpCtx.ResponseWriter.(*responseWriter); ok {
+		return w.size
+	}
+
+	return 0
+}
@@ -0,0 +1,40 @@
+package hfw
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestResponseWriter(t *testing.T) {
+	rec := httptest.NewRecorder()
+	httpCtx := &HTTPContext{ResponseWriter: newResponseWriter(rec), HTTPStatus: http.StatusOK}
+	if httpCtx.ResponseStatus() != http.StatusOK || httpCtx.ResponseSize() != 0 {
+		t.Fatal("expect HTTPStatus before write")
+	}
+
+	//HandlerFunc直接输出，HTTPStatus不变
+	http.Redirect(httpCtx.ResponseWriter, httptest.NewRequest("GET", "/", nil), "/login", http.StatusFound)
+	if httpCtx.ResponseStatus() != http.StatusFound || httpCtx.ResponseSize() != int64(rec.Body.Len()) {
+		t.Errorf("status: %d size: %d", httpCtx.ResponseStatus(), httpCtx.ResponseSize())
+	}
+
+	w := newResponseWriter(httptest.NewRecorder())
+	if newResponseWriter(w) != w {
+		t.Error("should not wrap twice")
+	}
+	w.WriteHeader(http.StatusEarlyHints)
+	if w.status != 0 {
+		t.Errorf("1xx is not final: %d", w.status)
+	}
+	w.Flush()
+	if w.status != http.StatusOK || w.firstByte.IsZero() {
+		t.Errorf("flush: %d", w.status)
+	}
+	if err := w.Push("/app.js", nil); err != http.ErrNotSupported {
+		t.Errorf("push: %v", err)
+	}
+	if _, _, err := w.Hijack(); err == nil {
+		t.Error("recorder can not hijack")
+	}
+}
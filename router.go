@@ -2,20 +2,20 @@ package hfw
 
 //手动匹配路由
 import (
-	"errors"
+	"context"
 	"fmt"
 	"net/http"
 	_ "net/http/pprof"
 	"path/filepath"
 	"reflect"
 	"strings"
-	"sync/atomic"
 	"time"
 
 	logger "github.com/hsyan2008/go-logger"
 	"github.com/hsyan2008/hfw/common"
+	"github.com/hsyan2008/hfw/configs"
 	"github.com/hsyan2008/hfw/grpc/server"
-	"github.com/hsyan2008/hfw/prometheus"
+	"go.opentelemetry.io/otel/trace"
 )
 
 //Router 写测试用例会调用
@@ -36,32 +36,22 @@ func Router(w http.ResponseWriter, r *http.Request) {
 	//初始化httpCtx
 	httpCtx := initCtx(w, r)
 	defer httpCtx.Cancel()
+	defer httpCtx.endSpan()
+	defer httpCtx.endRequest(time.Now())
 
 	//如果用户关闭连接
 	go closeNotify(httpCtx)
 
-	prometheus.RequestsTotal(r.URL.Path, r.Method)
-	defer func(path, method string, startTime time.Time) {
-		costTime := time.Since(startTime)
-		httpCtx.Mixf("Path:%s Method:%s CostTime:%s", path, method, costTime)
-		prometheus.RequestsCosttime(path, method, costTime)
-	}(r.URL.Path, r.Method, time.Now())
-
-	onlineNum := atomic.AddUint32(&online, 1)
-	httpCtx.Mixf("From:%s Path:%s Online:%d", r.RemoteAddr, r.URL.String(), onlineNum)
-	defer func() {
-		atomic.AddUint32(&online, ^uint32(0))
-	}()
-	err := checkConcurrence(onlineNum)
-	if err != nil {
-		w.WriteHeader(http.StatusServiceUnavailable)
-		httpCtx.Warn(err)
+	if routeTree.isEmpty() {
+		httpCtx.Warn(httpCtx.Request.URL.Path, "nil routeTree")
+		(&Controller{}).NotFound(httpCtx)
 		return
 	}
 
-	if len(routeMap) == 0 && len(routeMapMethod) == 0 {
-		httpCtx.Warn(httpCtx.Request.URL.Path, "nil routeMap or routeMapMethod")
-		(&Controller{}).NotFound(httpCtx)
+	//跨域，预检请求直接返回
+	if httpCtx.handleCors(func(method string) bool {
+		return routeExists(httpCtx.Request.URL.Path, method)
+	}) {
 		return
 	}
 
@@ -71,52 +61,69 @@ func Router(w http.ResponseWriter, r *http.Request) {
 
 	instance, methodName := findInstanceByPath(httpCtx)
 	httpCtx.Debugf("Path:%s -> Call:%s/%s", httpCtx.Request.URL.Path, httpCtx.Controller, httpCtx.Action)
+	httpCtx.instance = instance
 	reflectVal := instance.reflectVal
 
 	//注意方法必须是大写开头，否则无法调用
 	reflectVal.MethodByName("Init").Call(initValue)
 	defer reflectVal.MethodByName("Finish").Call(initValue)
 
-	defer recoverPanic(httpCtx, reflectVal, initValue)
+	controllerName := instance.controllerName
+	if methodName == NotFound {
+		//NotFound不使用controller的中间件，分组的NotFound使用分组的中间件
+		controllerName = ""
+	}
+
+	runMiddlewares(httpCtx, getMiddlewares(instance.pattern, controllerName, instance.group), func(httpCtx *HTTPContext) {
+		defer recoverPanic(httpCtx)
+
+		//SetMiddlewares去掉了SessionMiddleware的时候也要创建
+		httpCtx.initSession()
 
-	reflectVal.MethodByName("Before").Call(initValue)
-	defer reflectVal.MethodByName("After").Call(initValue)
+		reflectVal.MethodByName("Before").Call(initValue)
+		defer reflectVal.MethodByName("After").Call(initValue)
 
-	reflectVal.MethodByName(methodName).Call(initValue)
+		reflectVal.MethodByName(methodName).Call(initValue)
+	})
 }
 
-func recoverPanic(httpCtx *HTTPContext, reflectVal reflect.Value, initValue []reflect.Value) {
+func recoverPanic(httpCtx *HTTPContext) {
 	//注意recover只能执行一次
 	if err := recover(); err != nil {
 		//用户触发的
 		if err == ErrStopRun {
 			return
 		}
-		httpCtx.Fatal(err, string(common.GetStack()))
-
-		reflectVal.MethodByName("ServerError").Call(initValue)
+		httpCtx.recordPanic(err, common.GetStack())
+		httpCtx.serverError()
 	}
 }
 
-func closeNotify(httpCtx *HTTPContext) {
-	if common.IsGoTest() {
-		return
-	}
-	<-httpCtx.Request.Context().Done()
-	httpCtx.Cancel()
+//recordPanic 记录日志，并保存panic和堆栈
+func (httpCtx *HTTPContext) recordPanic(err interface{}, stack []byte) {
+	httpCtx.Fatal(err, string(stack))
+	httpCtx.panicValue, httpCtx.panicStack = err, stack
 }
 
-var online uint32
-
-func checkConcurrence(onlineNum uint32) (err error) {
-	if common.IsGoTest() || Config.Server.Concurrence <= 0 {
-		return nil
+//调用对应controller的ServerError
+func (httpCtx *HTTPContext) serverError() {
+	if httpCtx.instance == nil {
+		(&Controller{}).ServerError(httpCtx)
+		return
 	}
+	httpCtx.instance.reflectVal.MethodByName("ServerError").Call([]reflect.Value{
+		reflect.ValueOf(httpCtx),
+	})
+}
 
-	if onlineNum > uint32(Config.Server.Concurrence) {
-		return errors.New("checkConcurrence: too many concurrence")
+func closeNotify(httpCtx *HTTPContext) {
+	//httptest.NewRequest等没有绑定连接的请求，Done是nil
+	done := httpCtx.Request.Context().Done()
+	if done == nil {
+		return
 	}
-	return nil
+	<-done
+	httpCtx.Cancel()
 }
 
 func init() {
@@ -125,14 +132,22 @@ func init() {
 
 var isInit bool
 
-//Handler 暂时只支持2段
+//Handler 注册controller，url由pattern和action组成
+//pattern支持:name参数段，如/user/:id/orders
+//pattern最后一段可以是*name通配段，如/files/*path，此时只注册默认action的方法
 func Handler(pattern string, handler ControllerInterface) (err error) {
+	return registerHandler(pattern, handler, nil)
+}
+
+//registerHandler g不为nil的时候，路由经过分组的中间件
+func registerHandler(pattern string, handler ControllerInterface, g *RouterGroup) (err error) {
 	if isInit == false {
 		isInit = true
 		http.HandleFunc("/", Router)
 	}
 
-	controllerPath := completeURL(pattern)
+	controllerPath := completePattern(pattern)
+	isCatchAll := hasCatchAll(controllerPath)
 
 	reflectVal := reflect.ValueOf(handler)
 	rt := reflectVal.Type()
@@ -154,30 +169,32 @@ func Handler(pattern string, handler ControllerInterface) (err error) {
 		switch m {
 		case "Init", "Before", "After", "Finish", "NotFound", "ServerError":
 		default:
-			actions, method, isMethod := getActionsAndMethod(m)
+			actions, method, _ := getActionsAndMethod(m)
 			value := &instance{
 				reflectVal:     reflectVal,
 				controllerName: controllerName,
 				methodName:     rt.Method(i).Name,
+				pattern:        controllerPath,
+				group:          g,
 			}
 			if defaultInstance == nil {
 				defaultInstance = value
 			}
 			for _, action := range actions {
-				if isMethod {
-					path := fmt.Sprintf("%s/%sfor%s", controllerPath, action, method)
-					if _, ok := routeMapMethod[path]; ok {
-						panic(path + "has exist")
+				path := fmt.Sprintf("%s/%s", controllerPath, action)
+				if isCatchAll {
+					//通配段后面不能再有action
+					if action != configs.Get().Route.DefaultAction {
+						logger.Warnf("pattern: %s has catch-all, ignore method: %s", pattern, m)
+						continue
 					}
-					routeMapMethod[path] = value
-					logger.Infof("pattern: %s register in routeMapMethod: %s", pattern, path)
+					path = controllerPath
+				}
+				routeTree.add(path, method, value)
+				if method == "" {
+					logger.Infof("pattern: %s register route: %s", pattern, path)
 				} else {
-					path := fmt.Sprintf("%s/%s", controllerPath, action)
-					if _, ok := routeMap[path]; ok {
-						panic(path + "has exist")
-					}
-					routeMap[path] = value
-					logger.Infof("pattern: %s register in routeMap: %s", pattern, path)
+					logger.Infof("pattern: %s register route: %s for %s", pattern, path, method)
 				}
 			}
 		}
@@ -188,6 +205,11 @@ func Handler(pattern string, handler ControllerInterface) (err error) {
 
 //HandlerFunc register HandlerFunc
 func HandlerFunc(pattern string, h http.HandlerFunc) {
+	registerHandlerFunc(pattern, h, nil)
+}
+
+//registerHandlerFunc g不为nil的时候，h经过分组的中间件
+func registerHandlerFunc(pattern string, h http.HandlerFunc, g *RouterGroup) {
 	logger.Infof("HandlerFunc: %s", pattern)
 	if pattern == "/" || pattern == "/logger/adjust" {
 		panic("http: multiple registrations for " + pattern)
@@ -195,32 +217,34 @@ func HandlerFunc(pattern string, h http.HandlerFunc) {
 	http.HandleFunc(pattern, func(w http.ResponseWriter, r *http.Request) {
 		httpCtx := initCtx(w, r)
 		defer httpCtx.Cancel()
+		defer httpCtx.endSpan()
+		defer httpCtx.endRequest(time.Now())
 
-		prometheus.RequestsTotal(r.URL.Path, r.Method)
-		defer func(path, method string, startTime time.Time) {
-			costTime := time.Since(startTime)
-			httpCtx.Mixf("Path:%s Method:%s CostTime:%s", path, method, costTime)
-			prometheus.RequestsCosttime(path, method, costTime)
-		}(r.URL.Path, r.Method, time.Now())
-
-		onlineNum := atomic.AddUint32(&online, 1)
-		httpCtx.Mixf("From:%s Path:%s Online:%d", r.RemoteAddr, r.URL.String(), onlineNum)
-		defer func() {
-			atomic.AddUint32(&online, ^uint32(0))
-			if err := recover(); err != nil {
-				if err == ErrStopRun {
-					return
-				}
-				httpCtx.Fatal(err, string(common.GetStack()))
-			}
-		}()
-		err := checkConcurrence(onlineNum)
-		if err != nil {
-			w.WriteHeader(http.StatusServiceUnavailable)
-			httpCtx.Warn(err)
+		//跨域，ServeMux已经匹配到路由，预检请求直接返回
+		if httpCtx.handleCors(func(string) bool { return true }) {
 			return
 		}
-		h(w, r)
+
+		//h里发起的请求使用当前的span作为上游
+		r = r.WithContext(trace.ContextWithSpan(r.Context(), httpCtx.span))
+		done := runMiddlewares(httpCtx, getMiddlewares(pattern, "", g), func(httpCtx *HTTPContext) {
+			//中间件设置的deadline
+			if deadline, ok := httpCtx.Ctx.Deadline(); ok {
+				ctx, cancel := context.WithDeadline(r.Context(), deadline)
+				defer cancel()
+				r = r.WithContext(ctx)
+			}
+			//h直接输出，先写入session的cookie
+			httpCtx.initSession()
+			if httpCtx.Session != nil {
+				httpCtx.Session.Close(r, httpCtx.ResponseWriter)
+			}
+			h(httpCtx.ResponseWriter, r)
+		})
+		//被中间件中止，h里panic的时候可能已经输出了
+		if !done && !httpCtx.isResponseWritten() {
+			httpCtx.RenderResponse()
+		}
 	})
 }
 
@@ -232,12 +256,8 @@ func Handle(pattern string, h http.Handler) {
 //StaticHandler ...
 //如pattern=css,dir=./static，则css在./static下
 func StaticHandler(pattern string, dir string) {
-	if !filepath.IsAbs(dir) {
-		dir = filepath.Join(common.GetAppPath(), dir)
-	}
-	if pattern != "/" {
-		pattern = "/" + strings.Trim(pattern, "/") + "/"
-	}
+	dir = getStaticDir(dir)
+	pattern = staticPattern(pattern)
 	logger.Info("StaticHandler", pattern, dir)
 	http.Handle(pattern, http.FileServer(http.Dir(dir)))
 }
@@ -245,14 +265,26 @@ func StaticHandler(pattern string, dir string) {
 //StaticStripHandler ...
 //如pattern=css,dir=./static/css，则css就是./static/css
 func StaticStripHandler(pattern string, dir string) {
+	dir = getStaticDir(dir)
+	pattern = staticPattern(pattern)
+	logger.Info("StaticStripHandler", pattern, dir)
+	http.Handle(pattern, http.StripPrefix(pattern, http.FileServer(http.Dir(dir))))
+}
+
+func getStaticDir(dir string) string {
 	if !filepath.IsAbs(dir) {
 		dir = filepath.Join(common.GetAppPath(), dir)
 	}
+
+	return dir
+}
+
+func staticPattern(pattern string) string {
 	if pattern != "/" {
 		pattern = "/" + strings.Trim(pattern, "/") + "/"
 	}
-	logger.Info("StaticStripHandler", pattern, dir)
-	http.Handle(pattern, http.StripPrefix(pattern, http.FileServer(http.Dir(dir))))
+
+	return pattern
 }
 
 //调整logger的设置
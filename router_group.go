@@ -0,0 +1,173 @@
+package hfw
+
+import (
+	"net/http"
+	"path"
+	"reflect"
+	"strings"
+
+	logger "github.com/hsyan2008/go-logger"
+)
+
+//RouterGroup 路由分组，组内共享前缀、中间件和NotFound
+//分组的中间件只对通过分组注册的路由生效，前缀相同的分组互不影响
+type RouterGroup struct {
+	prefix string
+	parent *RouterGroup
+	mws    []Middleware
+	//SetNotFoundHandler设置的，nil的时候使用父分组或者defaultInstance的NotFound
+	notFound *instance
+}
+
+var (
+	//key是分组前缀，用于匹配不到路由的时候，前缀相同的优先使用设置了NotFound的分组
+	notFoundGroups = make(map[string]*RouterGroup)
+)
+
+//Group 新建路由分组，mws对组内的Handler、HandlerFunc、StaticHandler都生效
+func Group(prefix string, mws ...Middleware) *RouterGroup {
+	return newGroup(path.Join("/", prefix), nil, mws)
+}
+
+//Group 新建子分组，继承父分组的前缀和中间件
+func (g *RouterGroup) Group(prefix string, mws ...Middleware) *RouterGroup {
+	return newGroup(path.Join(g.prefix, prefix), g, mws)
+}
+
+func newGroup(prefix string, parent *RouterGroup, mws []Middleware) *RouterGroup {
+	g := &RouterGroup{
+		prefix: prefix,
+		parent: parent,
+	}
+	g.Use(mws...)
+
+	key := groupKey(prefix)
+	if _, ok := notFoundGroups[key]; !ok {
+		notFoundGroups[key] = g
+	}
+
+	return g
+}
+
+//Prefix 分组的前缀
+func (g *RouterGroup) Prefix() string {
+	return g.prefix
+}
+
+//Use 添加分组的中间件，子分组也会生效
+func (g *RouterGroup) Use(mws ...Middleware) {
+	if len(mws) > 0 {
+		g.mws = append(g.mws, mws...)
+		resetChainCache()
+	}
+}
+
+//middlewares 父分组的在前，g可以是nil
+func (g *RouterGroup) middlewares() (mws []Middleware) {
+	if g == nil {
+		return
+	}
+
+	return append(g.parent.middlewares(), g.mws...)
+}
+
+//Handler 同hfw.Handler，pattern会加上分组前缀
+func (g *RouterGroup) Handler(pattern string, handler ControllerInterface) (err error) {
+	return registerHandler(g.path(pattern), handler, g)
+}
+
+//HandlerFunc 同hfw.HandlerFunc，pattern会加上分组前缀
+func (g *RouterGroup) HandlerFunc(pattern string, h http.HandlerFunc) {
+	registerHandlerFunc(g.path(pattern), h, g)
+}
+
+//Handle 同hfw.Handle，pattern会加上分组前缀
+func (g *RouterGroup) Handle(pattern string, h http.Handler) {
+	registerHandlerFunc(g.path(pattern), h.ServeHTTP, g)
+}
+
+//StaticHandler 同hfw.StaticHandler，pattern会加上分组前缀，并且经过分组的中间件
+func (g *RouterGroup) StaticHandler(pattern string, dir string) {
+	pattern = staticPattern(g.path(pattern))
+	logger.Info("StaticHandler", pattern, getStaticDir(dir))
+	registerHandlerFunc(pattern, http.FileServer(http.Dir(getStaticDir(dir))).ServeHTTP, g)
+}
+
+//StaticStripHandler 同hfw.StaticStripHandler，pattern会加上分组前缀，并且经过分组的中间件
+func (g *RouterGroup) StaticStripHandler(pattern string, dir string) {
+	pattern = staticPattern(g.path(pattern))
+	logger.Info("StaticStripHandler", pattern, getStaticDir(dir))
+	registerHandlerFunc(pattern, http.StripPrefix(pattern, http.FileServer(http.Dir(getStaticDir(dir)))).ServeHTTP, g)
+}
+
+//SetNotFoundHandler 分组内匹配不到路由的时候，调用handler的NotFound
+//不设置的时候使用父分组的或者默认的NotFound，同样经过分组的中间件
+func (g *RouterGroup) SetNotFoundHandler(handler ControllerInterface) {
+	reflectVal := reflect.ValueOf(handler)
+	key := groupKey(g.prefix)
+	g.notFound = &instance{
+		reflectVal:     reflectVal,
+		controllerName: reflect.Indirect(reflectVal).Type().Name(),
+		methodName:     NotFound,
+		pattern:        key,
+		group:          g,
+	}
+	notFoundGroups[key] = g
+	logger.Infof("group: %s register NotFound controller: %s", g.prefix, g.notFound.controllerName)
+}
+
+func (g *RouterGroup) path(pattern string) string {
+	p := path.Join(g.prefix, pattern)
+	//保留结尾的/，HandlerFunc需要用来匹配子路径
+	if strings.HasSuffix(pattern, "/") && !strings.HasSuffix(p, "/") {
+		p += "/"
+	}
+
+	return p
+}
+
+func groupKey(prefix string) string {
+	return strings.Join(splitPath(prefix), "/")
+}
+
+//findNotFoundInstance 按最长前缀查找分组，返回的pattern是分组的前缀，用于匹配中间件
+//找不到分组的时候使用defaultInstance，不经过任何分组的中间件
+func findNotFoundInstance(path string) *instance {
+	segments := splitPath(path)
+	length := -1
+	var g *RouterGroup
+	var prefix string
+FOR:
+	for key, v := range notFoundGroups {
+		keySegments := splitPath(key)
+		if len(keySegments) > len(segments) || len(keySegments) <= length {
+			continue
+		}
+		for i, seg := range keySegments {
+			if !strings.EqualFold(seg, segments[i]) {
+				continue FOR
+			}
+		}
+		g, prefix, length = v, key, len(keySegments)
+	}
+	//子分组没有设置NotFound的时候使用父分组的，但经过子分组的中间件
+	base := defaultInstance
+	for p := g; p != nil; p = p.parent {
+		if p.notFound != nil {
+			base = p.notFound
+			break
+		}
+	}
+	if base == nil || base.group == g {
+		return base
+	}
+
+	//defaultInstance可能属于某个分组，复制一份
+	return &instance{
+		reflectVal:     base.reflectVal,
+		controllerName: base.controllerName,
+		methodName:     NotFound,
+		pattern:        prefix,
+		group:          g,
+	}
+}
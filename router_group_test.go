@@ -0,0 +1,87 @@
+package hfw
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+type groupTestController struct {
+	Controller
+}
+
+func (ctl *groupTestController) Index(httpCtx *HTTPContext) {
+	httpCtx.Data["name"] = "index"
+}
+
+type groupNotFoundController struct {
+	Controller
+}
+
+func (ctl *groupNotFoundController) NotFound(httpCtx *HTTPContext) {
+	ctl.Controller.NotFound(httpCtx)
+	httpCtx.ErrMsg = "group not found"
+}
+
+func TestRouterGroup(t *testing.T) {
+	var trace []string
+	mark := func(name string) Middleware {
+		return func(next ContextHandler) ContextHandler {
+			return func(httpCtx *HTTPContext) {
+				trace = append(trace, name)
+				next(httpCtx)
+			}
+		}
+	}
+	serve := func(path string) *httptest.ResponseRecorder {
+		trace = nil
+		w := httptest.NewRecorder()
+		http.DefaultServeMux.ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+		return w
+	}
+
+	api := Group("/test_group", mark("api"))
+	v1 := api.Group("v1", mark("v1"))
+	//前缀相同的分组，中间件互不影响
+	other := Group("/test_group/v1", mark("other"))
+	if v1.Prefix() != "/test_group/v1" {
+		t.Errorf("prefix: %s", v1.Prefix())
+	}
+	_ = v1.Handler("/user", &groupTestController{})
+	v1.HandlerFunc("/func", func(w http.ResponseWriter, r *http.Request) {})
+	other.HandlerFunc("/other", func(w http.ResponseWriter, r *http.Request) {})
+	//分组外的路由不经过分组的中间件
+	_ = Handler("/test_group_outside", &groupTestController{})
+
+	for _, v := range []struct {
+		path   string
+		status int
+		trace  string
+	}{
+		{"/test_group/v1/user/index", http.StatusOK, "api,v1"},
+		{"/test_group/v1/func", http.StatusOK, "api,v1"},
+		{"/test_group/v1/other", http.StatusOK, "other"},
+		{"/test_group_outside/index", http.StatusOK, ""},
+		//没有设置NotFound的分组，使用默认的NotFound并经过分组的中间件
+		{"/test_group/v1/none", http.StatusNotFound, "api,v1"},
+		{"/test_group/none", http.StatusNotFound, "api"},
+		{"/test_group_none", http.StatusNotFound, ""},
+	} {
+		w := serve(v.path)
+		if w.Code != v.status || strings.Join(trace, ",") != v.trace {
+			t.Errorf("path: %s, status: %d, trace: %v", v.path, w.Code, trace)
+		}
+	}
+
+	api.SetNotFoundHandler(&groupNotFoundController{})
+	if w := serve("/test_group/none"); w.Code != http.StatusNotFound ||
+		!strings.Contains(w.Body.String(), "group not found") || strings.Join(trace, ",") != "api" {
+		t.Errorf("status: %d, body: %s, trace: %v", w.Code, w.Body.String(), trace)
+	}
+	//子分组没有设置NotFound，使用父分组的，但经过子分组的中间件
+	if w := serve("/test_group/v1/none"); !strings.Contains(w.Body.String(), "group not found") ||
+		strings.Join(trace, ",") != "api,v1" {
+		t.Errorf("body: %s, trace: %v", w.Body.String(), trace)
+	}
+}
@@ -6,6 +6,7 @@ import (
 	"strings"
 
 	logger "github.com/hsyan2008/go-logger"
+	"github.com/hsyan2008/hfw/configs"
 	"github.com/hsyan2008/hfw/encoding"
 )
 
@@ -14,6 +15,10 @@ type instance struct {
 	controllerName string
 	//方法名字
 	methodName string
+	//注册时的pattern，用于匹配中间件
+	pattern string
+	//注册时的分组，nil表示不属于分组
+	group *RouterGroup
 }
 
 const (
@@ -21,17 +26,14 @@ const (
 )
 
 var (
-	routeMap         = make(map[string]*instance)
-	routeMapMethod   = make(map[string]*instance)
 	routeMapRegister = make(map[string]string)
 	defaultInstance  *instance
 )
 
 //controller如果有下划线，可以直接在注册的时候指定
 //action的下划线，可以自动处理
+//路由规则里可以有:name参数段和*name通配段，通过httpCtx.Param获取
 func findInstanceByPath(httpCtx *HTTPContext) (instance *instance, action string) {
-	var ok bool
-
 	defer func() {
 		httpCtx.Controller = instance.controllerName
 		httpCtx.Action = action
@@ -44,45 +46,75 @@ func findInstanceByPath(httpCtx *HTTPContext) (instance *instance, action string
 		inputPath = httpCtx.Path
 	}
 
-	//假设url上没有action
+	method := httpCtx.Request.Method
 	controllerPath := completeURL(inputPath)
-	httpCtx.Action = Config.Route.DefaultAction
-	httpCtx.Path = fmt.Sprintf("%s/%s", controllerPath, httpCtx.Action)
-	if instance, ok = routeMapMethod[httpCtx.Path+"for"+httpCtx.Request.Method]; ok {
-		return instance, instance.methodName
-	}
-	if instance, ok = routeMap[httpCtx.Path]; ok {
-		return instance, instance.methodName
-	}
 
-	//假设url上最后一段是action
-	tmp := strings.Split(controllerPath, "/")
-	controllerPath = strings.Join(tmp[:len(tmp)-1], "/")
-	httpCtx.Action = tmp[len(tmp)-1]
-	httpCtx.Path = fmt.Sprintf("%s/%s", controllerPath, httpCtx.Action)
-	if instance, ok = routeMapMethod[httpCtx.Path+"for"+httpCtx.Request.Method]; ok {
-		return instance, instance.methodName
+	//假设url上没有action，或者最后一段是action
+	ins, path, pattern, params := routeTree.findAction(controllerPath, configs.Get().Route.DefaultAction, method)
+	if ins != nil {
+		httpCtx.Path = path
+		return httpCtx.setRoute(ins, pattern, params)
 	}
-	if instance, ok = routeMap[httpCtx.Path]; ok {
-		return instance, instance.methodName
+
+	//最后匹配通配段
+	httpCtx.Path = controllerPath
+	if ins, pattern, params := routeTree.find(httpCtx.Path, method, true); ins != nil {
+		return httpCtx.setRoute(ins, pattern, params)
 	}
 
 	httpCtx.Action = strings.ToLower(NotFound)
 
-	//defaultInstance可能是nil，但Router已有判断
-	return defaultInstance, NotFound
+	//优先使用分组的NotFound，defaultInstance可能是nil，但Router已有判断
+	instance = findNotFoundInstance(controllerPath)
+	httpCtx.Route = instance.pattern
+	httpCtx.params = nil
+
+	return instance, NotFound
+}
+
+//routeExists 判断path是否注册了method，不包括NotFound，用于预检请求
+func routeExists(path, method string) bool {
+	controllerPath := completeURL(path)
+	if ins, _, _ := routeTree.find(controllerPath+"/"+configs.Get().Route.DefaultAction, method, false); ins != nil {
+		return true
+	}
+	ins, _, _ := routeTree.find(controllerPath, method, true)
+
+	return ins != nil
+}
+
+func (httpCtx *HTTPContext) setRoute(ins *instance, pattern string, params map[string]string) (*instance, string) {
+	httpCtx.Route = pattern
+	httpCtx.params = params
+
+	return ins, ins.methodName
 }
 
 func completeURL(url string) string {
-	//去掉前缀并把url补全为2段
-	trimURL := strings.Trim(strings.ToLower(url), "/")
+	//去掉前缀，静态段在路由树里不区分大小写，参数值需要保持原样
+	trimURL := strings.Trim(url, "/")
 	if trimURL == "" {
-		trimURL = Config.Route.DefaultController
+		trimURL = configs.Get().Route.DefaultController
 	}
 
 	return trimURL
 }
 
+//注册用，静态段转为小写，参数名保持原样
+func completePattern(pattern string) string {
+	segments := splitPath(pattern)
+	for i, seg := range segments {
+		if seg[0] != ':' && seg[0] != '*' {
+			segments[i] = strings.ToLower(seg)
+		}
+	}
+	if len(segments) == 0 {
+		return configs.Get().Route.DefaultController
+	}
+
+	return strings.Join(segments, "/")
+}
+
 //actions包含小写和下划线两种格式的方法名，已去重
 func getActionsAndMethod(funcName string) (actions []string, method string, isMethod bool) {
 	if len(funcName) == 0 {
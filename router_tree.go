@@ -0,0 +1,231 @@
+package hfw
+
+import (
+	"fmt"
+	"strings"
+)
+
+//路由树，支持静态段、:name参数段和*name通配段
+//匹配优先级：静态段 > 参数段 > 通配段
+//静态段不区分大小写，参数值保持原样
+type routeNode struct {
+	//静态段已转为小写，或者:name、*name
+	segment string
+
+	static     map[string]*routeNode
+	paramChild *routeNode
+	catchAll   *routeNode
+
+	//完整的路由规则，如user/:id/orders/index
+	pattern string
+	//key是http方法，空字符串表示不限方法
+	handlers map[string]*instance
+}
+
+type routeParam struct {
+	key   string
+	value string
+}
+
+var routeTree = newRouteNode("")
+
+func newRouteNode(segment string) *routeNode {
+	return &routeNode{
+		segment: segment,
+		static:  make(map[string]*routeNode),
+	}
+}
+
+func (n *routeNode) isEmpty() bool {
+	return len(n.static) == 0 && n.paramChild == nil && n.catchAll == nil && len(n.handlers) == 0
+}
+
+//add 注册路由，冲突的时候panic，以便启动时就发现问题
+func (n *routeNode) add(pattern, method string, ins *instance) {
+	segments := splitPath(pattern)
+	names := make(map[string]bool)
+	for i, seg := range segments {
+		switch seg[0] {
+		case ':', '*':
+			name := seg[1:]
+			if name == "" {
+				panic(fmt.Sprintf("route %s: wildcard must be named", pattern))
+			}
+			if names[name] {
+				panic(fmt.Sprintf("route %s: duplicate wildcard name %s", pattern, name))
+			}
+			names[name] = true
+			if seg[0] == '*' {
+				if i != len(segments)-1 {
+					panic(fmt.Sprintf("route %s: catch-all %s must be the last segment", pattern, seg))
+				}
+				if n.catchAll == nil {
+					n.catchAll = newRouteNode(seg)
+				} else if n.catchAll.segment != seg {
+					panic(fmt.Sprintf("route %s: %s conflicts with existing wildcard %s", pattern, seg, n.catchAll.segment))
+				}
+				n = n.catchAll
+			} else {
+				if n.paramChild == nil {
+					n.paramChild = newRouteNode(seg)
+				} else if n.paramChild.segment != seg {
+					panic(fmt.Sprintf("route %s: %s conflicts with existing wildcard %s", pattern, seg, n.paramChild.segment))
+				}
+				n = n.paramChild
+			}
+		default:
+			seg = strings.ToLower(seg)
+			child, ok := n.static[seg]
+			if !ok {
+				child = newRouteNode(seg)
+				n.static[seg] = child
+			}
+			n = child
+		}
+	}
+
+	if n.handlers == nil {
+		n.handlers = make(map[string]*instance)
+	}
+	if _, ok := n.handlers[method]; ok {
+		if method == "" {
+			panic(pattern + " has exist")
+		}
+		panic(fmt.Sprintf("%s for %s has exist", pattern, method))
+	}
+	n.pattern = strings.Join(segments, "/")
+	n.handlers[method] = ins
+}
+
+//find 查找路由，allowCatchAll为false时不匹配通配段
+func (n *routeNode) find(path, method string, allowCatchAll bool) (ins *instance, pattern string, params map[string]string) {
+	var ps []routeParam
+	leaf := n.match(splitPath(path), method, allowCatchAll, &ps)
+	if leaf == nil {
+		return
+	}
+	if ins = leaf.handlers[method]; ins == nil {
+		ins = leaf.handlers[""]
+	}
+	if len(ps) > 0 {
+		params = make(map[string]string, len(ps))
+		for _, p := range ps {
+			params[p.key] = p.value
+		}
+	}
+
+	return ins, leaf.pattern, params
+}
+
+//findAction 分别假设url上没有action和最后一段是action查找，都匹配的时候按段比较，静态段优先，相同的时候使用默认action
+//返回匹配时使用的path，不匹配通配段
+func (n *routeNode) findAction(controllerPath, defaultAction, method string) (ins *instance, path, pattern string, params map[string]string) {
+	path = controllerPath + "/" + defaultAction
+	ins, pattern, params = n.find(path, method, false)
+	exactIns, exactPattern, exactParams := n.find(controllerPath, method, false)
+	if exactIns != nil && (ins == nil || moreStatic(exactPattern, pattern, len(splitPath(controllerPath)))) {
+		return exactIns, controllerPath, exactPattern, exactParams
+	}
+
+	return
+}
+
+//moreStatic 比较两个规则的前num段，第一个不同类型的段上a是静态段的返回true
+func moreStatic(a, b string, num int) bool {
+	as, bs := splitPath(a), splitPath(b)
+	for i := 0; i < num && i < len(as) && i < len(bs); i++ {
+		if ka, kb := segmentKind(as[i]), segmentKind(bs[i]); ka != kb {
+			return ka < kb
+		}
+	}
+
+	return false
+}
+
+//segmentKind 静态段0，参数段1，通配段2
+func segmentKind(seg string) int {
+	switch seg[0] {
+	case ':':
+		return 1
+	case '*':
+		return 2
+	}
+
+	return 0
+}
+
+func (n *routeNode) match(segments []string, method string, allowCatchAll bool, ps *[]routeParam) *routeNode {
+	if len(segments) == 0 {
+		if n.hasHandler(method) {
+			return n
+		}
+		//通配段可以匹配空
+		if allowCatchAll && n.catchAll != nil && n.catchAll.hasHandler(method) {
+			*ps = append(*ps, routeParam{n.catchAll.segment[1:], ""})
+			return n.catchAll
+		}
+		return nil
+	}
+
+	if child, ok := n.static[strings.ToLower(segments[0])]; ok {
+		if leaf := child.match(segments[1:], method, allowCatchAll, ps); leaf != nil {
+			return leaf
+		}
+	}
+
+	if n.paramChild != nil {
+		num := len(*ps)
+		*ps = append(*ps, routeParam{n.paramChild.segment[1:], segments[0]})
+		if leaf := n.paramChild.match(segments[1:], method, allowCatchAll, ps); leaf != nil {
+			return leaf
+		}
+		*ps = (*ps)[:num]
+	}
+
+	if allowCatchAll && n.catchAll != nil && n.catchAll.hasHandler(method) {
+		*ps = append(*ps, routeParam{n.catchAll.segment[1:], strings.Join(segments, "/")})
+		return n.catchAll
+	}
+
+	return nil
+}
+
+func (n *routeNode) hasHandler(method string) bool {
+	if len(n.handlers) == 0 {
+		return false
+	}
+	if _, ok := n.handlers[method]; ok {
+		return true
+	}
+	_, ok := n.handlers[""]
+	return ok
+}
+
+func splitPath(path string) []string {
+	var segments []string
+	for _, seg := range strings.Split(path, "/") {
+		if seg != "" {
+			segments = append(segments, seg)
+		}
+	}
+	return segments
+}
+
+//hasPathPrefix 按段判断前缀，不区分大小写
+func hasPathPrefix(segments, prefix []string) bool {
+	if len(prefix) > len(segments) {
+		return false
+	}
+	for i, seg := range prefix {
+		if !strings.EqualFold(seg, segments[i]) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func hasCatchAll(pattern string) bool {
+	segments := splitPath(pattern)
+	return len(segments) > 0 && segments[len(segments)-1][0] == '*'
+}
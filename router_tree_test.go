@@ -0,0 +1,93 @@
+package hfw
+
+import (
+	"testing"
+)
+
+func TestRouteTreeFind(t *testing.T) {
+	tree := newRouteNode("")
+	index := &instance{methodName: "Index"}
+	orders := &instance{methodName: "Orders"}
+	ordersPost := &instance{methodName: "OrdersForPOST"}
+	files := &instance{methodName: "Index"}
+
+	tree.add("user/index", "", index)
+	tree.add("user/:id/orders", "", orders)
+	tree.add("user/:id/orders", "POST", ordersPost)
+	tree.add("files/*path", "", files)
+
+	cases := []struct {
+		path, method  string
+		allowCatchAll bool
+		ins           *instance
+		params        map[string]string
+	}{
+		{"user/index", "GET", false, index, nil},
+		{"User/Index", "GET", false, index, nil},
+		{"user/AbC/orders", "GET", false, orders, map[string]string{"id": "AbC"}},
+		{"user/10/orders", "POST", false, ordersPost, map[string]string{"id": "10"}},
+		{"files/a/b.txt", "GET", false, nil, nil},
+		{"files/a/b.txt", "GET", true, files, map[string]string{"path": "a/b.txt"}},
+		{"files", "GET", true, files, map[string]string{"path": ""}},
+		{"user/10", "GET", true, nil, nil},
+	}
+
+	for _, c := range cases {
+		ins, _, params := tree.find(c.path, c.method, c.allowCatchAll)
+		if ins != c.ins {
+			t.Errorf("%s %s: got %v, want %v", c.method, c.path, ins, c.ins)
+			continue
+		}
+		if len(params) != len(c.params) {
+			t.Errorf("%s %s: got params %v, want %v", c.method, c.path, params, c.params)
+			continue
+		}
+		for k, v := range c.params {
+			if params[k] != v {
+				t.Errorf("%s %s: got params %v, want %v", c.method, c.path, params, c.params)
+			}
+		}
+	}
+}
+
+func TestRouteTreeFindAction(t *testing.T) {
+	tree := newRouteNode("")
+	info := &instance{methodName: "Info"}
+	user := &instance{methodName: "Index"}
+	tree.add("user/info", "", info)
+	tree.add("user/:id/index", "", user)
+
+	//静态段优先于参数段
+	ins, path, _, params := tree.findAction("user/info", "index", "GET")
+	if ins != info || path != "user/info" || params != nil {
+		t.Errorf("user/info: got %v %s %v", ins, path, params)
+	}
+	ins, path, _, params = tree.findAction("user/10", "index", "GET")
+	if ins != user || path != "user/10/index" || params["id"] != "10" {
+		t.Errorf("user/10: got %v %s %v", ins, path, params)
+	}
+}
+
+func TestRouteTreeConflict(t *testing.T) {
+	cases := [][]string{
+		{"user/:id", "user/:uid/info"},
+		{"files/*path", "files/*name"},
+		{"user/index", "user/index"},
+		{"files/*path/info"},
+		{"user/:id/:id"},
+	}
+
+	for _, patterns := range cases {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("%v: expect panic", patterns)
+				}
+			}()
+			tree := newRouteNode("")
+			for _, p := range patterns {
+				tree.add(p, "", &instance{})
+			}
+		}()
+	}
+}
@@ -4,7 +4,9 @@ import (
 	"net/http"
 
 	"github.com/hsyan2008/hfw/common"
+	"github.com/hsyan2008/hfw/configs"
 	"github.com/hsyan2008/hfw/signal"
+	"github.com/hsyan2008/hfw/tracing"
 )
 
 //Run start
@@ -14,6 +16,8 @@ func Run() (err error) {
 
 	signalContext.Mix("Starting ...")
 	defer signalContext.Mix("Shutdowned!")
+	//全部结束后上报剩余的span
+	defer func() { _ = tracing.Shutdown() }()
 
 	signalContext.Mixf("Running, VERSION=%s, ENVIRONMENT=%s, APPNAME=%s, APPPATH=%s",
 		common.GetVersion(), common.GetEnv(), common.GetAppName(), common.GetAppPath())
@@ -21,6 +25,9 @@ func Run() (err error) {
 	//监听信号
 	go signalContext.Listen()
 
+	//自定义的配置一般在Run之前已经加载
+	configs.WarnUnmatchedSets()
+
 	//等待工作完成
 	defer signalContext.Shutdowned()
 
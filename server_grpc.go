@@ -2,9 +2,9 @@ package hfw
 
 import (
 	"context"
-	"errors"
 	"net"
-	"sync/atomic"
+	"net/http"
+	"strings"
 	"time"
 
 	logger "github.com/hsyan2008/go-logger"
@@ -12,12 +12,16 @@ import (
 	"github.com/hsyan2008/hfw/configs"
 	"github.com/hsyan2008/hfw/grpc/discovery"
 	"github.com/hsyan2008/hfw/grpc/server"
-	"github.com/hsyan2008/hfw/prometheus"
 	"github.com/hsyan2008/hfw/signal"
+	"github.com/hsyan2008/hfw/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
 	"google.golang.org/grpc/reflection"
 	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
 )
 
 //如果是https+证书grpc，请配置好Server并使用NewGrpcServer+hfw.Run
@@ -25,8 +29,13 @@ import (
 //如果是grpc+http，请配置好Server和GrpcServer并使用NewGrpcServer+hfw.RunGrpc+hfw.Run
 
 func NewGrpcServer(config configs.AllConfig) (s *grpc.Server, err error) {
-	return server.NewServer(config.Server.ServerConfig, grpc.UnaryInterceptor(UnaryServerInterceptor),
+	s, err = server.NewServer(config.Server.ServerConfig, grpc.UnaryInterceptor(UnaryServerInterceptor),
 		grpc.StreamInterceptor(StreamServerInterceptor))
+	if err == nil && config.Health.IsEnable {
+		registerGrpcHealth(s)
+	}
+
+	return
 }
 
 var grpcListener net.Listener
@@ -42,6 +51,8 @@ func RunGrpc(s *grpc.Server, config configs.GrpcServerConfig) (err error) {
 
 	signalContext.Mix("grpc server Starting ...")
 	defer signalContext.Mix("grpc server Shutdowned!")
+	//全部结束后上报剩余的span
+	defer func() { _ = tracing.Shutdown() }()
 
 	//等待工作完成
 	defer signalContext.Shutdowned()
@@ -62,7 +73,10 @@ func RunGrpc(s *grpc.Server, config configs.GrpcServerConfig) (err error) {
 		return err
 	}
 	if r != nil {
-		defer r.UnRegister()
+		//等处理中的请求结束后再注销
+		signal.OnShutdown("grpc deregister", signal.PriorityDeregister, func(context.Context) error {
+			return r.UnRegister()
+		})
 	}
 
 	go func() {
@@ -103,33 +117,28 @@ func UnaryServerInterceptor(
 		}
 	}()
 
-	startTime := time.Now()
-	prometheus.RequestsTotal(info.FullMethod, "GRPC")
-	defer func() {
-		costTime := time.Since(startTime)
-		httpCtx.Mixf("Method:%s CostTime:%s", "GRPC", costTime)
-		prometheus.RequestsCosttime(info.FullMethod, "GRPC", costTime)
-	}()
+	httpCtx.requestPath = info.FullMethod
+	httpCtx.requestMethod = "GRPC"
 
-	onlineNum := atomic.AddUint32(&online, 1)
-	httpCtx.Mixf("Online:%d", onlineNum)
-	defer func() {
-		atomic.AddUint32(&online, ^uint32(0))
-		if e := recover(); e != nil {
-			if e == ErrStopRun {
-				return
-			}
-			err = errors.New("panic")
-			httpCtx.Fatal(err, string(common.GetStack()))
+	span := httpCtx.startGrpcSpan(info.FullMethod)
+	defer func() { endGrpcSpan(span, err) }()
+	defer func(startTime time.Time) {
+		var size int
+		if m, ok := resp.(proto.Message); ok {
+			size = proto.Size(m)
 		}
-	}()
+		httpCtx.endGrpcRequest(startTime, err, size)
+	}(time.Now())
 
-	err = checkConcurrence(onlineNum)
-	if err != nil {
-		return
+	done := runMiddlewares(httpCtx, getMiddlewares(info.FullMethod, "", nil), func(httpCtx *HTTPContext) {
+		resp, err = handler(httpCtx, req)
+	})
+	//被中间件中止或者超时
+	if !done || httpCtx.HTTPStatus == http.StatusGatewayTimeout {
+		resp, err = nil, grpcStatusError(httpCtx)
 	}
 
-	return handler(httpCtx, req)
+	return
 }
 
 func StreamServerInterceptor(
@@ -147,33 +156,116 @@ func StreamServerInterceptor(
 		}
 	}()
 
-	startTime := time.Now()
-	prometheus.RequestsTotal(info.FullMethod, "Stream")
-	defer func() {
-		costTime := time.Since(startTime)
-		httpCtx.Mixf("Method:%s CostTime:%s", "Stream", costTime)
-		prometheus.RequestsCosttime(info.FullMethod, "Stream", costTime)
-	}()
+	httpCtx.requestPath = info.FullMethod
+	httpCtx.requestMethod = "Stream"
 
-	onlineNum := atomic.AddUint32(&online, 1)
-	httpCtx.Mixf("Online:%d", onlineNum)
-	defer func() {
-		atomic.AddUint32(&online, ^uint32(0))
-		if e := recover(); e != nil {
-			if e == ErrStopRun {
-				return
-			}
-			err = errors.New("panic")
-			httpCtx.Fatal(err, string(common.GetStack()))
-		}
-	}()
+	span := httpCtx.startGrpcSpan(info.FullMethod)
+	defer func() { endGrpcSpan(span, err) }()
+	defer func(startTime time.Time) {
+		httpCtx.endGrpcRequest(startTime, err, 0)
+	}(time.Now())
 
-	err = checkConcurrence(onlineNum)
-	if err != nil {
-		return
+	done := runMiddlewares(httpCtx, getMiddlewares(info.FullMethod, "", nil), func(httpCtx *HTTPContext) {
+		err = handler(srv, WarpServerStream(ss, httpCtx))
+	})
+	//被中间件中止或者超时
+	if !done || httpCtx.HTTPStatus == http.StatusGatewayTimeout {
+		err = grpcStatusError(httpCtx)
+	}
+
+	return
+}
+
+//startGrpcSpan 从metadata获取上游的traceparent，创建server span
+func (httpCtx *HTTPContext) startGrpcSpan(fullMethod string) (span trace.Span) {
+	md, _ := metadata.FromIncomingContext(httpCtx.Ctx)
+	httpCtx.Ctx, span = tracing.Start(tracing.ExtractMetadata(httpCtx.Ctx, md),
+		strings.TrimPrefix(fullMethod, "/"), trace.SpanKindServer,
+		attribute.String("rpc.system", "grpc"),
+		attribute.String("rpc.method", fullMethod),
+		tracing.AttrTraceID.String(httpCtx.GetTraceID()),
+	)
+
+	return
+}
+
+func endGrpcSpan(span trace.Span, err error) {
+	span.SetAttributes(attribute.Int64("rpc.grpc.status_code", int64(status.Code(err))))
+	tracing.End(span, err)
+}
+
+//endGrpcRequest grpc请求结束的时候记录监控、访问日志和上报错误
+func (httpCtx *HTTPContext) endGrpcRequest(startTime time.Time, err error, size int) {
+	code := status.Code(err)
+	httpCtx.recordMetrics(code.String(), grpcHTTPStatus(code) >= http.StatusInternalServerError)
+	httpCtx.writeGrpcAccessLog(startTime, err, size)
+	if httpCtx.panicValue != nil {
+		httpCtx.reportError(httpCtx.panicValue, httpCtx.panicStack)
+	} else if err != nil && grpcHTTPStatus(code) >= http.StatusInternalServerError {
+		httpCtx.reportError(err, nil)
+	}
+}
+
+//grpcHTTPStatus grpc的code对应的http状态码，和grpc-gateway一致
+func grpcHTTPStatus(code codes.Code) int {
+	switch code {
+	case codes.OK:
+		return http.StatusOK
+	case codes.Canceled:
+		return 499
+	case codes.InvalidArgument, codes.FailedPrecondition, codes.OutOfRange:
+		return http.StatusBadRequest
+	case codes.Unauthenticated:
+		return http.StatusUnauthorized
+	case codes.PermissionDenied:
+		return http.StatusForbidden
+	case codes.NotFound:
+		return http.StatusNotFound
+	case codes.AlreadyExists, codes.Aborted:
+		return http.StatusConflict
+	case codes.ResourceExhausted:
+		return http.StatusTooManyRequests
+	case codes.Unimplemented:
+		return http.StatusNotImplemented
+	case codes.Unavailable:
+		return http.StatusServiceUnavailable
+	case codes.DeadlineExceeded:
+		return http.StatusGatewayTimeout
+	}
+
+	return http.StatusInternalServerError
+}
+
+//grpcStatusError 把中间件设置的HTTPStatus和ErrMsg转为grpc的错误
+func grpcStatusError(httpCtx *HTTPContext) error {
+	var code codes.Code
+	switch httpCtx.HTTPStatus {
+	case 0, http.StatusOK:
+		//StopRun
+		code = codes.Aborted
+	case http.StatusBadRequest:
+		code = codes.InvalidArgument
+	case http.StatusUnauthorized:
+		code = codes.Unauthenticated
+	case http.StatusForbidden:
+		code = codes.PermissionDenied
+	case http.StatusNotFound:
+		code = codes.NotFound
+	case http.StatusTooManyRequests:
+		code = codes.ResourceExhausted
+	case http.StatusServiceUnavailable:
+		code = codes.Unavailable
+	case http.StatusGatewayTimeout:
+		code = codes.DeadlineExceeded
+	default:
+		code = codes.Internal
+	}
+	errMsg := httpCtx.ErrMsg
+	if errMsg == "" {
+		errMsg = http.StatusText(httpCtx.HTTPStatus)
 	}
 
-	return handler(srv, WarpServerStream(ss, httpCtx))
+	return status.Error(code, errMsg)
 }
 
 func WarpServerStream(ss grpc.ServerStream, httpCtx *HTTPContext) *GrpcServerStream {
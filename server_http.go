@@ -3,9 +3,13 @@
 package hfw
 
 import (
+	"context"
+	"errors"
 	"net"
 	"net/http"
+	"os"
 	"sync"
+	"syscall"
 	"time"
 
 	logger "github.com/hsyan2008/go-logger"
@@ -13,6 +17,7 @@ import (
 	"github.com/hsyan2008/hfw/common"
 	"github.com/hsyan2008/hfw/configs"
 	"github.com/hsyan2008/hfw/grpc/discovery"
+	"github.com/hsyan2008/hfw/signal"
 )
 
 var listener net.Listener
@@ -86,16 +91,56 @@ func StartHTTP(config configs.HTTPServerConfig) (err error) {
 		return err
 	}
 	if r != nil {
-		defer r.UnRegister()
+		//Serve返回的时候请求可能还没处理完，和grpc一样等处理中的请求结束后再注销
+		signal.OnShutdown("http deregister", signal.PriorityDeregister, func(context.Context) error {
+			return r.UnRegister()
+		})
 	}
 
+	//gracehttp的Serve收到信号会立即Shutdown，readiness来不及摘除流量
+	//所以只用它创建和继承listener，关闭和重启由signal按阶段处理
+	signal.OnShutdown("http server", signal.PriorityStopAccept, s.Server.Shutdown)
+	signal.SetRestart(restartHTTP)
+
 	if common.IsExist(config.CertFile) && common.IsExist(config.KeyFile) {
 		logger.Mix("Listen on https:", listener.Addr().String())
-		err = s.ListenAndServeTLS(config.CertFile, config.KeyFile)
+		err = s.Server.ServeTLS(listener, config.CertFile, config.KeyFile)
 	} else {
 		logger.Mix("Listen on http:", listener.Addr().String())
-		err = s.ListenAndServe()
+		err = s.Server.Serve(listener)
 	}
 
 	return
 }
+
+//restartHTTP 启动新的进程，listener通过fd 3传递，新进程的gracehttp按IS_GRACEFUL环境变量继承
+func restartHTTP() error {
+	tl, ok := listener.(*net.TCPListener)
+	if !ok {
+		return errors.New("listener is not tcp")
+	}
+	f, err := tl.File()
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	var envs []string
+	for _, v := range os.Environ() {
+		if v != gracehttp.GRACEFUL_ENVIRON_STRING {
+			envs = append(envs, v)
+		}
+	}
+	envs = append(envs, gracehttp.GRACEFUL_ENVIRON_STRING)
+
+	pid, _, err := syscall.StartProcess(os.Args[0], os.Args, &syscall.ProcAttr{
+		Env:   envs,
+		Files: []uintptr{os.Stdin.Fd(), os.Stdout.Fd(), os.Stderr.Fd(), f.Fd()},
+	})
+	if err != nil {
+		return err
+	}
+	logger.Mix("start new process success, pid:", pid)
+
+	return nil
+}
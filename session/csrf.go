@@ -0,0 +1,50 @@
+package session
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+)
+
+//CSRFKey session里保存csrf token的key
+const CSRFKey = "_csrf_token"
+
+//CSRFToken 获取session的csrf token，没有则生成并保存
+func (s *Session) CSRFToken() (token string, err error) {
+	if s.csrfToken != "" {
+		return s.csrfToken, nil
+	}
+	if !s.isNew {
+		if err = s.store.Get(&token, s.id, CSRFKey); err == nil && token != "" {
+			s.csrfToken = token
+			return
+		}
+	}
+
+	b := make([]byte, 32)
+	if _, err = rand.Read(b); err != nil {
+		return
+	}
+	token = base64.RawURLEncoding.EncodeToString(b)
+	if err = s.store.Put(s.id, CSRFKey, token); err != nil {
+		return "", err
+	}
+	s.csrfToken = token
+
+	return
+}
+
+//CheckCSRFToken 校验token是否和session里的一致
+func (s *Session) CheckCSRFToken(token string) bool {
+	if token == "" || s.isNew {
+		return false
+	}
+	var stored string
+	if s.csrfToken != "" {
+		stored = s.csrfToken
+	} else if err := s.store.Get(&stored, s.id, CSRFKey); err != nil || stored == "" {
+		return false
+	}
+
+	return subtle.ConstantTimeCompare([]byte(stored), []byte(token)) == 1
+}
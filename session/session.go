@@ -8,7 +8,8 @@ import (
 	"github.com/hsyan2008/hfw/configs"
 )
 
-type sessionStoreInterface interface {
+//Store session的存储，默认是redis，测试的时候可以使用NewSessMemoryStore
+type Store interface {
 	SetExpiration(int64)
 	Put(string, string, interface{}) error
 	Get(interface{}, string, string) error
@@ -22,10 +23,12 @@ type Session struct {
 	id         string
 	newid      string
 	isNew      bool
-	store      sessionStoreInterface
+	store      Store
 	cookieName string
 	reName     bool
 	expiration int64
+	csrfToken  string
+	closed     bool
 }
 
 var sessPool = sync.Pool{
@@ -34,7 +37,7 @@ var sessPool = sync.Pool{
 	},
 }
 
-func NewSession(request *http.Request, store sessionStoreInterface, config configs.SessionConfig) (s *Session) {
+func NewSession(request *http.Request, store Store, config configs.SessionConfig) (s *Session) {
 	// s := sessPool.Get().(*Session)
 	if config.CookieName == "" {
 		config.CookieName = "sess_name"
@@ -64,7 +67,12 @@ func NewSession(request *http.Request, store sessionStoreInterface, config confi
 	return
 }
 
+//Close 需要的时候重命名session，新的session写入cookie，重复调用只执行一次
 func (s *Session) Close(request *http.Request, response http.ResponseWriter) {
+	if s.closed {
+		return
+	}
+	s.closed = true
 	if !s.isNew && s.reName {
 		err := s.Rename()
 		if err == nil {
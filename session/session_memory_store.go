@@ -0,0 +1,92 @@
+package session
+
+import (
+	"errors"
+	"sync"
+
+	"github.com/hsyan2008/hfw/encoding"
+)
+
+//sessMemoryStore 保存在内存里，不会过期，也不能多进程共享，主要用于测试
+type sessMemoryStore struct {
+	mu   sync.RWMutex
+	data map[string]map[string][]byte
+}
+
+var _ Store = &sessMemoryStore{}
+
+func NewSessMemoryStore() *sessMemoryStore {
+	return &sessMemoryStore{
+		data: make(map[string]map[string][]byte),
+	}
+}
+
+func (s *sessMemoryStore) SetExpiration(expiration int64) {
+}
+
+func (s *sessMemoryStore) IsExist(sessid, key string) (value bool, err error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	_, value = s.data[sessid][key]
+
+	return
+}
+
+func (s *sessMemoryStore) Put(sessid, key string, value interface{}) (err error) {
+	b, err := encoding.JSON.Marshal(value)
+	if err != nil {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.data[sessid] == nil {
+		s.data[sessid] = make(map[string][]byte)
+	}
+	s.data[sessid][key] = b
+
+	return
+}
+
+func (s *sessMemoryStore) Get(value interface{}, sessid, key string) (err error) {
+	s.mu.RLock()
+	b, ok := s.data[sessid][key]
+	s.mu.RUnlock()
+	if !ok {
+		return
+	}
+
+	return encoding.JSON.Unmarshal(b, value)
+}
+
+func (s *sessMemoryStore) Del(sessid, key string) (err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.data[sessid], key)
+
+	return
+}
+
+func (s *sessMemoryStore) Destroy(sessid string) (err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.data, sessid)
+
+	return
+}
+
+func (s *sessMemoryStore) Rename(sessid, newid string) (err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.data[newid]; ok {
+		return errors.New(newid + " is exist")
+	}
+	data, ok := s.data[sessid]
+	if !ok {
+		return errors.New(sessid + " is not exist")
+	}
+	s.data[newid] = data
+	delete(s.data, sessid)
+
+	return
+}
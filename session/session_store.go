@@ -14,7 +14,7 @@ type sessRedisStore struct {
 	expiration int64
 }
 
-var _ sessionStoreInterface = &sessRedisStore{}
+var _ Store = &sessRedisStore{}
 
 var sessRedisStoreIns *sessRedisStore
 var once = new(sync.Once)
@@ -0,0 +1,145 @@
+package signal
+
+import (
+	"context"
+	"os"
+	"runtime"
+	"sort"
+	"sync"
+	"time"
+)
+
+//OnShutdown的priority，从小到大分阶段执行，同一个priority的并发执行，前一个阶段全部结束才执行下一个
+const (
+	//摘除流量，如readiness返回失败，等待负载均衡感知
+	PriorityNotReady = 50
+	//停止接收新的请求和任务，内置的hook会取消Ctx，通知http、grpc服务和业务方
+	PriorityStopAccept = 100
+	//等待处理中的请求，内置的hook会等待Wg
+	PriorityDrain = 200
+	//从注册中心注销
+	PriorityDeregister = 300
+	//关闭连接池，如redis、db
+	PriorityClosePool = 400
+)
+
+//超过这个时间的hook打印warn
+const slowHookThreshold = time.Second
+
+type shutdownHook struct {
+	name     string
+	priority int
+	f        func(ctx context.Context) error
+}
+
+var (
+	hooksMu sync.Mutex
+	hooks   []*shutdownHook
+
+	shutdownTimeout = 30 * time.Second
+
+	//超时后退出，测试的时候替换
+	exit = os.Exit
+)
+
+func init() {
+	OnShutdown("signal ctx cancel", PriorityStopAccept, func(context.Context) error {
+		scx.Cancel()
+		return nil
+	})
+	OnShutdown("signal ctx waitgroup", PriorityDrain, func(context.Context) error {
+		scx.WgWait()
+		return nil
+	})
+}
+
+//OnShutdown 注册退出的时候执行的hook，ctx在总的超时时间到了之后结束
+func OnShutdown(name string, priority int, f func(ctx context.Context) error) {
+	hooksMu.Lock()
+	defer hooksMu.Unlock()
+	hooks = append(hooks, &shutdownHook{name: name, priority: priority, f: f})
+}
+
+//SetShutdownTimeout 设置退出的总超时时间，默认30秒，超时后打印所有goroutine的堆栈并退出
+func SetShutdownTimeout(timeout time.Duration) {
+	if timeout > 0 {
+		hooksMu.Lock()
+		defer hooksMu.Unlock()
+		shutdownTimeout = timeout
+	}
+}
+
+//runHooks 按阶段执行hook，超时的时候返回还没结束的hook
+func (ctx *signalContext) runHooks(c context.Context) (pending []string) {
+	hooksMu.Lock()
+	list := make([]*shutdownHook, len(hooks))
+	copy(list, hooks)
+	hooksMu.Unlock()
+
+	sort.SliceStable(list, func(i, j int) bool {
+		return list[i].priority < list[j].priority
+	})
+	for i := 0; i < len(list); {
+		j := i + 1
+		for j < len(list) && list[j].priority == list[i].priority {
+			j++
+		}
+		pending = ctx.runPhase(c, list[i:j])
+		if len(pending) > 0 {
+			return
+		}
+		i = j
+	}
+
+	return
+}
+
+func (ctx *signalContext) runPhase(c context.Context, phase []*shutdownHook) (pending []string) {
+	done := make(chan int, len(phase))
+	for i, h := range phase {
+		go func(i int, h *shutdownHook) {
+			defer func() { done <- i }()
+			startTime := time.Now()
+			err := h.f(c)
+			costTime := time.Since(startTime)
+			if err != nil {
+				ctx.Warnf("shutdown hook %s failed: %v, CostTime: %s", h.name, err, costTime)
+			} else if costTime >= slowHookThreshold {
+				ctx.Warnf("shutdown hook %s is slow, CostTime: %s", h.name, costTime)
+			} else {
+				ctx.Infof("shutdown hook %s done, CostTime: %s", h.name, costTime)
+			}
+		}(i, h)
+	}
+
+	finished := make([]bool, len(phase))
+	for left := len(phase); left > 0; left-- {
+		select {
+		case i := <-done:
+			finished[i] = true
+		case <-c.Done():
+			for i, ok := range finished {
+				if !ok {
+					pending = append(pending, phase[i].name)
+				}
+			}
+			return
+		}
+	}
+
+	return
+}
+
+//dumpStacks 打印所有goroutine的堆栈，用于排查退出超时
+func (ctx *signalContext) dumpStacks() {
+	buf := make([]byte, 1<<20)
+	for {
+		n := runtime.Stack(buf, true)
+		if n < len(buf) {
+			buf = buf[:n]
+			break
+		}
+		buf = make([]byte, 2*len(buf))
+	}
+	ctx.Errorf("total goroutine: %d\n%s", runtime.NumGoroutine(), buf)
+}
@@ -0,0 +1,63 @@
+package signal
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestRunHooks(t *testing.T) {
+	old := hooks
+	defer func() {
+		hooks = old
+	}()
+	hooks = nil
+
+	var mu sync.Mutex
+	var order []string
+	add := func(name string, priority int, d time.Duration, err error) {
+		OnShutdown(name, priority, func(ctx context.Context) error {
+			select {
+			case <-time.After(d):
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+			mu.Lock()
+			order = append(order, name)
+			mu.Unlock()
+			return err
+		})
+	}
+	add("pool", PriorityClosePool, 0, nil)
+	add("drain", PriorityDrain, 20*time.Millisecond, nil)
+	add("stop", PriorityStopAccept, 0, errors.New("ignored"))
+	add("deregister", PriorityDeregister, 0, nil)
+
+	c, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if pending := scx.runHooks(c); len(pending) > 0 {
+		t.Fatalf("pending: %v", pending)
+	}
+	if want := []string{"stop", "drain", "deregister", "pool"}; !reflect.DeepEqual(order, want) {
+		t.Errorf("order: %v, want: %v", order, want)
+	}
+
+	//超时后返回还没结束的hook，后面的阶段不执行
+	hooks, order = nil, nil
+	add("fast", PriorityDrain, 0, nil)
+	OnShutdown("stuck", PriorityDrain, func(context.Context) error {
+		select {}
+	})
+	add("pool", PriorityClosePool, 0, nil)
+	c, cancel = context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if pending := scx.runHooks(c); !reflect.DeepEqual(pending, []string{"stuck"}) {
+		t.Errorf("pending: %v", pending)
+	}
+	if !reflect.DeepEqual(order, []string{"fast"}) {
+		t.Errorf("order: %v", order)
+	}
+}
@@ -3,6 +3,8 @@
 //kill -TERM pid 重启
 //需要调用Wg.Add()
 //需要监听Shutdown通道
+//kill -HUP pid 非http程序重新加载配置
+//连接池等资源通过OnShutdown注册，退出的时候按阶段关闭
 package signal
 
 import (
@@ -11,10 +13,10 @@ import (
 	"os/signal"
 	"sync"
 	"syscall"
-	"time"
 
 	"github.com/hsyan2008/go-logger"
 	"github.com/hsyan2008/hfw/common"
+	"github.com/hsyan2008/hfw/configs"
 )
 
 type signalContext struct {
@@ -54,7 +56,7 @@ func GetSignalContext() *signalContext {
 	return scx
 }
 
-//gracehttp外，增加两个信号支持
+//Listen 处理退出、平滑重启和非http程序的重新加载配置，http服务也不再由gracehttp处理信号
 func (ctx *signalContext) Listen() {
 	if ctx.isListened {
 		return
@@ -68,6 +70,7 @@ func (ctx *signalContext) Listen() {
 	ctx.Mixf("Exec `kill -TERM %d` will graceful restart", os.Getpid())
 
 	var s os.Signal
+LOOP:
 	select {
 	case <-ctx.Ctx.Done():
 		s = syscall.SIGINT
@@ -84,27 +87,55 @@ func (ctx *signalContext) Listen() {
 		ctx.Mix("recv cancel")
 	case s = <-c:
 		ctx.Mix("recv signal:", s)
+		//http的SIGHUP和原来gracehttp一样是退出
+		if s == syscall.SIGHUP && !ctx.IsHTTP {
+			if err := configs.Reload(); err != nil {
+				ctx.Warn("reload config:", err)
+			}
+			goto LOOP
+		}
+		if s == syscall.SIGTERM {
+			if err := ctx.restart(); err != nil {
+				ctx.Errorf("start new process failed: %v, continue serving", err)
+				goto LOOP
+			}
+		}
 	}
 
-	go ctx.doShutdownDone()
 	if ctx.IsHTTP {
 		ctx.Mix("Stopping http server")
-		//已有第三方处理
 	} else {
 		ctx.Mix("Stopping console server")
-		switch s {
-		case syscall.SIGTERM:
-			execSpec := &syscall.ProcAttr{
-				Env:   os.Environ(),
-				Files: []uintptr{os.Stdin.Fd(), os.Stdout.Fd(), os.Stderr.Fd()},
-			}
-			_, _, err := syscall.StartProcess(os.Args[0], os.Args, execSpec)
-			if err != nil {
-				ctx.Errorf("failed to forkexec: %v", err)
-			}
-		case syscall.SIGHUP, syscall.SIGQUIT, syscall.SIGINT:
-		}
 	}
+	//http服务也在hook里关闭，readiness先返回失败
+	go ctx.doShutdownDone()
+}
+
+var restartFunc func() error
+
+//SetRestart 设置SIGTERM平滑重启的时候启动新进程的方法，如http服务需要把listener传给新进程
+//返回error的时候不退出，继续运行
+func SetRestart(f func() error) {
+	hooksMu.Lock()
+	defer hooksMu.Unlock()
+	restartFunc = f
+}
+
+func (ctx *signalContext) restart() error {
+	hooksMu.Lock()
+	f := restartFunc
+	hooksMu.Unlock()
+	if f != nil {
+		return f()
+	}
+
+	execSpec := &syscall.ProcAttr{
+		Env:   os.Environ(),
+		Files: []uintptr{os.Stdin.Fd(), os.Stdout.Fd(), os.Stderr.Fd()},
+	}
+	_, _, err := syscall.StartProcess(os.Args[0], os.Args, execSpec)
+
+	return err
 }
 
 func (ctx *signalContext) doShutdownDone() {
@@ -118,27 +149,19 @@ func (ctx *signalContext) doShutdownDone() {
 	ctx.Mix("doShutdownDone start.")
 	defer ctx.Mix("doShutdownDone done.")
 
-	go ctx.waitDone()
-
-	timeout := 30
-	select {
-	case <-time.After(time.Duration(timeout) * time.Second):
-		ctx.Warnf("doShutdownDone %ds timeout", timeout)
-		close(ctx.done)
-	case <-ctx.done:
+	hooksMu.Lock()
+	timeout := shutdownTimeout
+	hooksMu.Unlock()
+	c, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	//依次取消Ctx通知业务方、等待业务方完成退出、注销服务、关闭连接池
+	if pending := ctx.runHooks(c); len(pending) > 0 {
+		ctx.Errorf("doShutdownDone %s timeout, pending hooks: %v", timeout, pending)
+		ctx.dumpStacks()
+		exit(1)
+		return
 	}
-}
-
-//通知业务方，并等待业务方结束
-func (ctx *signalContext) waitDone() {
-	//context包来取消，以通知业务方
-	ctx.Mix("signal ctx cancel")
-	ctx.Cancel()
-	//等待业务方完成退出
-	ctx.Mix("signal ctx waitgroup wait done start")
-	ctx.WgWait()
-	//表示全部完成
-	ctx.Mix("signal ctx waitgroup wait done end")
 	close(ctx.done)
 }
 
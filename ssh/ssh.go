@@ -11,6 +11,7 @@ import (
 	"github.com/hsyan2008/hfw"
 	"github.com/hsyan2008/hfw/common"
 	"github.com/hsyan2008/hfw/encoding"
+	"github.com/hsyan2008/hfw/signal"
 	"golang.org/x/crypto/ssh"
 )
 
@@ -64,6 +65,30 @@ var mt = new(sync.Mutex)
 
 var sshIns = make(map[string]*SSH)
 
+func init() {
+	signal.OnShutdown("ssh", signal.PriorityClosePool, closeAll)
+}
+
+//closeAll 退出的时候关闭所有的连接，不管引用计数
+func closeAll(context.Context) error {
+	mt.Lock()
+	defer mt.Unlock()
+	for key, ins := range sshIns {
+		ins.mt.Lock()
+		ins.ref = 0
+		if ins.httpCtx != nil {
+			ins.httpCtx.Cancel()
+		}
+		if ins.c != nil {
+			_ = ins.c.Close()
+		}
+		ins.mt.Unlock()
+		delete(sshIns, key)
+	}
+
+	return nil
+}
+
 //NewSSH 建立第一个ssh连接，一般是跳板机
 func NewSSH(sshConfig SSHConfig) (ins *SSH, err error) {
 
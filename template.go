@@ -0,0 +1,367 @@
+package hfw
+
+import (
+	"context"
+	"fmt"
+	"html"
+	"html/template"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	logger "github.com/hsyan2008/go-logger"
+	"github.com/hsyan2008/hfw/common"
+	"github.com/hsyan2008/hfw/configs"
+	"github.com/hsyan2008/hfw/signal"
+)
+
+//key是layout和模板，见templateKey
+var templatesCache = struct {
+	list map[string]*template.Template
+	l    *sync.RWMutex
+}{
+	list: make(map[string]*template.Template),
+	l:    &sync.RWMutex{},
+}
+
+//全局的FuncMap，所有模板和WidgetsPath都可以使用
+var defaultFuncMap = struct {
+	m template.FuncMap
+	l *sync.RWMutex
+}{
+	m: template.FuncMap{},
+	l: &sync.RWMutex{},
+}
+
+//templateConfig 当前的模板配置，测试里可以替换
+var templateConfig = func() configs.TemplateConfig {
+	return configs.Get().Template
+}
+
+//widgets只加载一次，每个模板使用它的Clone
+var widgetsCache = struct {
+	t *template.Template
+	l *sync.Mutex
+}{
+	l: &sync.Mutex{},
+}
+
+//RegisterFuncMap 注册全局的FuncMap，请在启动前注册
+//httpCtx.FuncMap里同名的函数会覆盖
+func RegisterFuncMap(funcMap template.FuncMap) {
+	defaultFuncMap.l.Lock()
+	defer defaultFuncMap.l.Unlock()
+	for k, v := range funcMap {
+		defaultFuncMap.m[k] = v
+	}
+}
+
+//newTemplate 使用全局FuncMap的模板
+func newTemplate(name string) *template.Template {
+	defaultFuncMap.l.RLock()
+	defer defaultFuncMap.l.RUnlock()
+
+	return template.New(name).Funcs(defaultFuncMap.m)
+}
+
+//Render ..
+//如果设置了Layout，执行的是Layout，模板里用{{define "name"}}覆盖Layout里的{{block "name" .}}
+func (httpCtx *HTTPContext) Render() {
+	t, err := httpCtx.render()
+	if err != nil {
+		httpCtx.renderTemplateError(err)
+		return
+	}
+
+	if len(httpCtx.ResponseWriter.Header().Get("Content-Type")) == 0 {
+		httpCtx.ResponseWriter.Header().Set("Content-Type", "text/html; charset=utf-8")
+	}
+
+	err = httpCtx.writeBody(func(w io.Writer) error {
+		if httpCtx.Layout != "" {
+			return t.ExecuteTemplate(w, filepath.Base(httpCtx.Layout), httpCtx)
+		}
+		return t.Execute(w, httpCtx)
+	})
+	// httpCtx.ThrowCheck(500, err)
+	if err != nil {
+		httpCtx.Warn(err)
+	}
+}
+
+//renderTemplateError 开发环境输出错误页面，否则按ServerError输出json
+func (httpCtx *HTTPContext) renderTemplateError(err error) {
+	httpCtx.Error("render template:", err)
+	if isDevMode() {
+		httpCtx.ResponseWriter.Header().Set("Content-Type", "text/html; charset=utf-8")
+		httpCtx.ResponseWriter.WriteHeader(http.StatusInternalServerError)
+		_, _ = fmt.Fprintf(httpCtx.ResponseWriter, templateErrorPage,
+			html.EscapeString(httpCtx.templateKey()), html.EscapeString(err.Error()))
+		return
+	}
+
+	httpCtx.serverError()
+	httpCtx.Template = ""
+	httpCtx.TemplateFile = ""
+	httpCtx.ReturnJSON()
+}
+
+const templateErrorPage = `<!DOCTYPE html>
+<html><head><meta charset="utf-8"><title>Template Error</title></head>
+<body style="font-family:monospace">
+<h2>Template Error</h2>
+<p>%s</p>
+<pre style="background:#fee;padding:10px;white-space:pre-wrap">%s</pre>
+</body></html>`
+
+func (httpCtx *HTTPContext) render() (t *template.Template, err error) {
+	var ok bool
+	key := httpCtx.templateKey()
+	c := templateConfig()
+
+	//开发环境下也使用缓存，由watchTemplates在文件修改后清空
+	if c.IsCache || isTemplateWatch(c) {
+		if isTemplateWatch(c) {
+			startTemplateWatch(c)
+		}
+		templatesCache.l.RLock()
+		if t, ok = templatesCache.list[key]; !ok {
+			templatesCache.l.RUnlock()
+			t, err = httpCtx.parseTemplate(c)
+			if err != nil {
+				return
+			}
+			templatesCache.l.Lock()
+			templatesCache.list[key] = t
+			templatesCache.l.Unlock()
+		} else {
+			templatesCache.l.RUnlock()
+		}
+	} else {
+		t, err = httpCtx.parseTemplate(c)
+	}
+
+	return
+}
+
+//templateKey 缓存的key，Template用路由规则，TemplateFile用文件名
+func (httpCtx *HTTPContext) templateKey() string {
+	var key string
+	if httpCtx.Template != "" {
+		key = httpCtx.templateName()
+	} else {
+		key = httpCtx.TemplateFile
+	}
+
+	return httpCtx.Layout + "|" + key
+}
+
+//templateName Template的模板名
+func (httpCtx *HTTPContext) templateName() string {
+	if httpCtx.Route != "" {
+		return httpCtx.Route
+	}
+
+	return httpCtx.Path
+}
+
+//parseTemplate 依次解析WidgetsPath、Layout、模板，后面的define覆盖前面的
+func (httpCtx *HTTPContext) parseTemplate(c configs.TemplateConfig) (t *template.Template, err error) {
+	var name string
+	if httpCtx.Template != "" {
+		name = httpCtx.templateName()
+	} else {
+		name = filepath.Base(httpCtx.TemplateFile)
+	}
+
+	widgets, err := getWidgets(c)
+	if err != nil {
+		return
+	}
+	if widgets == nil {
+		t = newTemplate(name)
+	} else if t, err = widgets.Clone(); err != nil {
+		return
+	}
+	if len(httpCtx.FuncMap) > 0 {
+		t = t.Funcs(httpCtx.FuncMap)
+	}
+
+	if httpCtx.Layout != "" {
+		if t, err = parseTemplateFile(t, c, httpCtx.Layout); err != nil {
+			return
+		}
+	}
+
+	if httpCtx.Template != "" {
+		t, err = t.New(name).Parse(httpCtx.Template)
+	} else {
+		t, err = parseTemplateFile(t, c, httpCtx.TemplateFile)
+	}
+	if err != nil {
+		return
+	}
+
+	return t.Lookup(name), nil
+}
+
+//parseTemplateFile 优先当前路径，然后HTMLPath下
+func parseTemplateFile(t *template.Template, c configs.TemplateConfig, file string) (*template.Template, error) {
+	var templateFilePath string
+	if common.IsExist(file) {
+		templateFilePath = file
+	} else {
+		templateFilePath = filepath.Join(c.HTMLPath, file)
+	}
+	if !common.IsExist(templateFilePath) {
+		return nil, fmt.Errorf("template path: %s not exist", file)
+	}
+	t, err := t.ParseFiles(templateFilePath)
+	if err != nil {
+		return nil, err
+	}
+	watchTemplateFiles(c, templateFilePath)
+
+	return t, nil
+}
+
+//getWidgets 没有配置WidgetsPath返回nil，只加载一次，开发环境下文件修改后重新加载
+func getWidgets(c configs.TemplateConfig) (*template.Template, error) {
+	if len(c.WidgetsPath) == 0 {
+		return nil, nil
+	}
+	widgetsCache.l.Lock()
+	defer widgetsCache.l.Unlock()
+	if widgetsCache.t != nil && (c.IsCache || isTemplateWatch(c)) {
+		return widgetsCache.t, nil
+	}
+	files, err := filepath.Glob(c.WidgetsPath)
+	if err != nil {
+		return nil, err
+	}
+	t, err := newTemplate("widgets").ParseGlob(c.WidgetsPath)
+	if err != nil {
+		return nil, err
+	}
+	watchTemplateFiles(c, files...)
+	widgetsCache.t = t
+
+	return t, nil
+}
+
+//记录模板文件的修改时间，用于判断是否需要清空缓存
+//cancel不是nil表示正在检查
+var templatesWatcher = struct {
+	files  map[string]templateFileStat
+	l      *sync.Mutex
+	cancel context.CancelFunc
+}{
+	files: make(map[string]templateFileStat),
+	l:     &sync.Mutex{},
+}
+
+type templateFileStat struct {
+	modTime time.Time
+	size    int64
+}
+
+//isDevMode 开发环境或者go run
+func isDevMode() bool {
+	return common.IsDevEnv() || common.IsGoRun()
+}
+
+//isTemplateWatch 开发环境或者go run下自动开启，也可以配置Template.IsWatch开启
+func isTemplateWatch(c configs.TemplateConfig) bool {
+	return c.IsWatch || isDevMode()
+}
+
+func watchTemplateFiles(c configs.TemplateConfig, files ...string) {
+	if !isTemplateWatch(c) {
+		return
+	}
+	templatesWatcher.l.Lock()
+	defer templatesWatcher.l.Unlock()
+	for _, file := range files {
+		if fi, err := os.Stat(file); err == nil {
+			templatesWatcher.files[file] = templateFileStat{fi.ModTime(), fi.Size()}
+		}
+	}
+}
+
+//startTemplateWatch 没有在检查的时候按c开始检查，配置修改后先stopTemplateWatch
+func startTemplateWatch(c configs.TemplateConfig) {
+	templatesWatcher.l.Lock()
+	defer templatesWatcher.l.Unlock()
+	if templatesWatcher.cancel != nil {
+		return
+	}
+	var ctx context.Context
+	ctx, templatesWatcher.cancel = context.WithCancel(signal.GetSignalContext().Ctx)
+	go watchTemplates(ctx, c)
+}
+
+func stopTemplateWatch() {
+	templatesWatcher.l.Lock()
+	defer templatesWatcher.l.Unlock()
+	if templatesWatcher.cancel != nil {
+		templatesWatcher.cancel()
+		templatesWatcher.cancel = nil
+	}
+}
+
+//watchTemplates 每秒检查一次已经加载的模板文件和WidgetsPath，有修改就清空缓存
+func watchTemplates(ctx context.Context, c configs.TemplateConfig) {
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	logger.Info("watch templates in", c.HTMLPath, c.WidgetsPath)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if file := changedTemplateFile(c.WidgetsPath); file != "" {
+				logger.Info("template changed:", file, "clear templates cache")
+				clearTemplatesCache()
+			}
+		}
+	}
+}
+
+func changedTemplateFile(widgetsPath string) string {
+	templatesWatcher.l.Lock()
+	defer templatesWatcher.l.Unlock()
+	for file, stat := range templatesWatcher.files {
+		fi, err := os.Stat(file)
+		if err != nil || !fi.ModTime().Equal(stat.modTime) || fi.Size() != stat.size {
+			return file
+		}
+	}
+	//新增的widgets
+	if len(widgetsPath) > 0 {
+		files, _ := filepath.Glob(widgetsPath)
+		for _, file := range files {
+			if _, ok := templatesWatcher.files[file]; !ok {
+				return file
+			}
+		}
+	}
+
+	return ""
+}
+
+func clearTemplatesCache() {
+	templatesWatcher.l.Lock()
+	templatesWatcher.files = make(map[string]templateFileStat)
+	templatesWatcher.l.Unlock()
+
+	widgetsCache.l.Lock()
+	widgetsCache.t = nil
+	widgetsCache.l.Unlock()
+
+	templatesCache.l.Lock()
+	templatesCache.list = make(map[string]*template.Template)
+	templatesCache.l.Unlock()
+}
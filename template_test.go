@@ -0,0 +1,79 @@
+package hfw
+
+import (
+	"html/template"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/hsyan2008/hfw/configs"
+)
+
+//setTemplateConfig 替换模板配置，不修改全局的Config，结束的时候恢复并停止检查
+func setTemplateConfig(t *testing.T, c configs.TemplateConfig) {
+	old := templateConfig
+	templateConfig = func() configs.TemplateConfig {
+		return c
+	}
+	t.Cleanup(func() {
+		stopTemplateWatch()
+		templateConfig = old
+		clearTemplatesCache()
+	})
+}
+
+func TestRenderLayout(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"layout.html":         `<html>{{block "content" .}}default{{end}}{{template "footer" .}}</html>`,
+		"index.html":          `{{define "content"}}{{upper .Data.name}}{{end}}`,
+		"widgets/footer.html": `{{define "footer"}}<p>{{upper "footer"}}</p>{{end}}`,
+	}
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	c := configs.TemplateConfig{HTMLPath: dir, WidgetsPath: filepath.Join(dir, "widgets", "*.html")}
+	setTemplateConfig(t, c)
+	RegisterFuncMap(template.FuncMap{"upper": strings.ToUpper})
+
+	w := httptest.NewRecorder()
+	httpCtx := &HTTPContext{
+		ResponseWriter: w,
+		HTTPStatus:     200,
+		Layout:         "layout.html",
+		TemplateFile:   "index.html",
+		Data:           map[string]interface{}{"name": "hfw"},
+	}
+	httpCtx.Render()
+
+	if got := w.Body.String(); got != "<html>HFW<p>FOOTER</p></html>" {
+		t.Errorf("got %s", got)
+	}
+
+	//修改后重新加载
+	if isTemplateWatch(c) {
+		err := os.WriteFile(filepath.Join(dir, "index.html"), []byte(`{{define "content"}}new{{end}}`), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if file := changedTemplateFile(c.WidgetsPath); file == "" {
+			t.Fatal("expect changed file")
+		}
+		clearTemplatesCache()
+		w = httptest.NewRecorder()
+		httpCtx.ResponseWriter = w
+		httpCtx.Render()
+		if got := w.Body.String(); got != "<html>new<p>FOOTER</p></html>" {
+			t.Errorf("got %s", got)
+		}
+	}
+}
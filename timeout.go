@@ -0,0 +1,69 @@
+package hfw
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/hsyan2008/hfw/configs"
+)
+
+//TimeoutMiddleware 按Server.Timeout和RouteTimeouts设置httpCtx.Ctx的deadline
+//api.Call、curl.Curl、grpc/client.Do都以这个deadline为上限
+//超时后controller和grpc失败的时候返回504，超时后成功的保留结果，HandlerFunc通过r.Context()获取deadline，需要自行处理
+func TimeoutMiddleware(next ContextHandler) ContextHandler {
+	return func(httpCtx *HTTPContext) {
+		timeout := routeTimeout(httpCtx.requestPath, httpCtx.requestMethod)
+		if timeout <= 0 {
+			next(httpCtx)
+			return
+		}
+
+		parent := httpCtx.Ctx
+		ctx, cancel := context.WithTimeout(parent, timeout)
+		defer cancel()
+		httpCtx.Ctx = ctx
+		//ThrowCheck等panic的时候也要处理
+		defer func() {
+			//Finish里输出的时候不受deadline影响
+			httpCtx.Ctx = parent
+
+			//超时后成功返回的保留结果，失败的才是超时导致的
+			if ctx.Err() == context.DeadlineExceeded && isRequestFailed(httpCtx) {
+				httpCtx.Warnf("request timeout: %s", timeout)
+				httpCtx.HTTPStatus = http.StatusGatewayTimeout
+				httpCtx.IsError = true
+				httpCtx.ErrNo = http.StatusGatewayTimeout
+				httpCtx.ErrMsg = "GatewayTimeout"
+				httpCtx.Results = nil
+			}
+		}()
+		next(httpCtx)
+	}
+}
+
+//isRequestFailed 设置了错误码或者5xx
+func isRequestFailed(httpCtx *HTTPContext) bool {
+	return httpCtx.ErrNo != 0 || httpCtx.IsError || httpCtx.HTTPStatus >= http.StatusInternalServerError
+}
+
+//routeTimeout 最长匹配的RouteTimeouts，没有匹配的用Server.Timeout
+func routeTimeout(path, method string) time.Duration {
+	c := configs.Get().Server
+	timeout := c.Timeout
+	segments := splitPath(path)
+	length := -1
+	for _, v := range c.RouteTimeouts {
+		if v.Method != "" && !strings.EqualFold(v.Method, method) {
+			continue
+		}
+		prefix := splitPath(v.Path)
+		if len(prefix) <= length || !hasPathPrefix(segments, prefix) {
+			continue
+		}
+		timeout, length = v.Timeout, len(prefix)
+	}
+
+	return timeout
+}
@@ -0,0 +1,60 @@
+package hfw
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/hsyan2008/hfw/configs"
+)
+
+func TestTimeoutMiddleware(t *testing.T) {
+	c := *configs.Get()
+	defer configs.Set(configs.Set(&c))
+	c.Server.Timeout = time.Second
+	c.Server.RouteTimeouts = []configs.RouteTimeout{
+		{Path: "/export", Timeout: 10 * time.Millisecond},
+		{Path: "/export/big", Method: "GET", Timeout: 0},
+	}
+
+	if d := routeTimeout("/user", "GET"); d != time.Second {
+		t.Errorf("default: %s", d)
+	}
+	if d := routeTimeout("/Export/csv", "GET"); d != 10*time.Millisecond {
+		t.Errorf("route: %s", d)
+	}
+	if d := routeTimeout("/export/big", "GET"); d != 0 {
+		t.Errorf("longest: %s", d)
+	}
+
+	httpCtx := NewHTTPContext()
+	defer httpCtx.Cancel()
+	httpCtx.HTTPStatus = http.StatusOK
+	httpCtx.requestPath, httpCtx.requestMethod = "/export/csv", "GET"
+	runMiddlewares(httpCtx, []Middleware{RecoverMiddleware, TimeoutMiddleware}, func(httpCtx *HTTPContext) {
+		if _, ok := httpCtx.Deadline(); !ok {
+			t.Error("expect deadline")
+		}
+		<-httpCtx.Done()
+		httpCtx.ThrowCheck(500, httpCtx.Err())
+	})
+	if httpCtx.HTTPStatus != http.StatusGatewayTimeout || httpCtx.ErrNo != http.StatusGatewayTimeout {
+		t.Errorf("expect 504, got %d", httpCtx.HTTPStatus)
+	}
+	if httpCtx.Err() != nil {
+		t.Error("ctx should be restored")
+	}
+
+	//超时后成功的保留结果
+	httpCtx = NewHTTPContext()
+	defer httpCtx.Cancel()
+	httpCtx.HTTPStatus = http.StatusOK
+	httpCtx.requestPath, httpCtx.requestMethod = "/export/csv", "GET"
+	runMiddlewares(httpCtx, []Middleware{TimeoutMiddleware}, func(httpCtx *HTTPContext) {
+		<-httpCtx.Done()
+		httpCtx.Results = "ok"
+	})
+	if httpCtx.HTTPStatus != http.StatusOK || httpCtx.ErrNo != 0 || httpCtx.Results != "ok" {
+		t.Errorf("expect 200, got %d %v", httpCtx.HTTPStatus, httpCtx.Results)
+	}
+}
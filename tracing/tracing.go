@@ -0,0 +1,212 @@
+//Package tracing 基于OpenTelemetry的链路追踪，使用W3C traceparent在http和grpc之间传递
+//没有开启的时候使用otel默认的noop实现，不产生span，也不传递traceparent
+package tracing
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/hsyan2008/hfw/common"
+	"github.com/hsyan2008/hfw/configs"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.17.0"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc/metadata"
+)
+
+const instrumentationName = "github.com/hsyan2008/hfw"
+
+//AttrTraceID span里记录日志用的trace id，方便从span查到日志
+const AttrTraceID = attribute.Key("hfw.trace_id")
+
+var (
+	provider *sdktrace.TracerProvider
+	//file的exporter打开的文件，Shutdown的时候关闭
+	file *os.File
+)
+
+//Init 按配置初始化全局的TracerProvider和traceparent传递
+func Init(c configs.TraceConfig) (err error) {
+	if !c.IsEnable {
+		return
+	}
+
+	exporter, err := newExporter(c)
+	if err != nil {
+		return err
+	}
+
+	ratio := c.SampleRatio
+	if ratio <= 0 || ratio > 1 {
+		ratio = 1
+	}
+
+	provider = sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(resource.NewWithAttributes(semconv.SchemaURL,
+			semconv.ServiceName(common.GetAppName()),
+			semconv.ServiceVersion(common.GetVersion()),
+			semconv.DeploymentEnvironment(common.GetEnv()),
+			semconv.HostName(common.GetHostName()),
+		)),
+		//有上游的时候跟随上游的采样结果
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(ratio))),
+	)
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(
+		propagation.TraceContext{}, propagation.Baggage{}))
+
+	return
+}
+
+func newExporter(c configs.TraceConfig) (sdktrace.SpanExporter, error) {
+	switch strings.ToLower(c.Exporter) {
+	case "otlp":
+		var opts []otlptracegrpc.Option
+		if c.Endpoint != "" {
+			opts = append(opts, otlptracegrpc.WithEndpoint(c.Endpoint))
+		}
+		if c.Insecure {
+			opts = append(opts, otlptracegrpc.WithInsecure())
+		}
+		return otlptracegrpc.New(context.Background(), opts...)
+	case "file":
+		f, err := os.OpenFile(filePath(c), os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+		if err != nil {
+			return nil, err
+		}
+		file = f
+		return stdouttrace.New(stdouttrace.WithWriter(f))
+	case "", "stdout":
+		return stdouttrace.New(stdouttrace.WithPrettyPrint())
+	}
+
+	return nil, errors.New("undefined trace exporter: " + c.Exporter)
+}
+
+//filePath 默认是日志文件所在目录，没有日志文件的时候是程序所在目录
+func filePath(c configs.TraceConfig) string {
+	if c.FilePath != "" {
+		return c.FilePath
+	}
+	dir := common.GetAppPath()
+	if logFile := configs.Get().Logger.LogFile; logFile != "" {
+		dir = filepath.Dir(logFile)
+	}
+
+	return filepath.Join(dir, common.GetAppName()+".trace")
+}
+
+//IsEnable 是否开启了链路追踪
+func IsEnable() bool {
+	return provider != nil
+}
+
+//Shutdown 输出还没上报的span，退出的时候调用
+func Shutdown() (err error) {
+	if provider == nil {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	err = provider.Shutdown(ctx)
+	//span写完之后才能关闭
+	if file != nil {
+		if e := file.Close(); err == nil {
+			err = e
+		}
+		file = nil
+	}
+
+	return
+}
+
+//Start 创建span，ctx里有span的时候作为子span
+func Start(ctx context.Context, name string, kind trace.SpanKind, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	return otel.Tracer(instrumentationName).Start(ctx, name,
+		trace.WithSpanKind(kind), trace.WithAttributes(attrs...))
+}
+
+//StartChild ctx里有span的时候才创建子span，用于db和redis，避免脚本等场景产生大量孤立的span
+func StartChild(ctx context.Context, name string, kind trace.SpanKind, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	if ctx == nil || !trace.SpanContextFromContext(ctx).IsValid() {
+		return ctx, trace.SpanFromContext(context.Background())
+	}
+
+	return Start(ctx, name, kind, attrs...)
+}
+
+//End 结束span，err不为nil的时候记录错误
+func End(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+//TraceID 返回ctx里span的W3C trace id，没有的时候返回空
+func TraceID(ctx context.Context) string {
+	sc := trace.SpanContextFromContext(ctx)
+	if !sc.IsValid() {
+		return ""
+	}
+
+	return sc.TraceID().String()
+}
+
+//ExtractHTTP 从http header里获取上游的traceparent
+func ExtractHTTP(ctx context.Context, header http.Header) context.Context {
+	return otel.GetTextMapPropagator().Extract(ctx, propagation.HeaderCarrier(header))
+}
+
+//InjectHTTP 把ctx里的span写入http header
+func InjectHTTP(ctx context.Context, header http.Header) {
+	otel.GetTextMapPropagator().Inject(ctx, propagation.HeaderCarrier(header))
+}
+
+//ExtractMetadata 从grpc的metadata里获取上游的traceparent
+func ExtractMetadata(ctx context.Context, md metadata.MD) context.Context {
+	return otel.GetTextMapPropagator().Extract(ctx, metadataCarrier(md))
+}
+
+//InjectMetadata 把ctx里的span写入grpc的metadata
+func InjectMetadata(ctx context.Context, md metadata.MD) {
+	otel.GetTextMapPropagator().Inject(ctx, metadataCarrier(md))
+}
+
+type metadataCarrier metadata.MD
+
+func (c metadataCarrier) Get(key string) string {
+	if v := metadata.MD(c).Get(key); len(v) > 0 {
+		return v[0]
+	}
+
+	return ""
+}
+
+func (c metadataCarrier) Set(key, value string) {
+	metadata.MD(c).Set(key, value)
+}
+
+func (c metadataCarrier) Keys() []string {
+	keys := make([]string, 0, len(c))
+	for k := range c {
+		keys = append(keys, k)
+	}
+
+	return keys
+}
@@ -0,0 +1,101 @@
+package tracing
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/hsyan2008/hfw/common"
+	"github.com/hsyan2008/hfw/configs"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc/metadata"
+)
+
+func TestPropagation(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	defer func() {
+		otel.SetTracerProvider(trace.NewNoopTracerProvider())
+		otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator())
+	}()
+
+	//没有上游的时候不创建子span
+	ctx, span := StartChild(context.Background(), "redis GET", trace.SpanKindClient)
+	span.End()
+	if TraceID(ctx) != "" || len(recorder.Ended()) != 0 {
+		t.Fatal("StartChild without parent should not record")
+	}
+
+	header := http.Header{}
+	header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	ctx, server := Start(ExtractHTTP(context.Background(), header), "HTTP GET", trace.SpanKindServer)
+	if TraceID(ctx) != "4bf92f3577b34da6a3ce929d0e0e4736" {
+		t.Fatalf("trace id: %s", TraceID(ctx))
+	}
+
+	ctx, client := Start(ctx, "user.User/Info", trace.SpanKindClient)
+	md := metadata.MD{}
+	InjectMetadata(ctx, md)
+	if len(md.Get("traceparent")) != 1 {
+		t.Fatalf("metadata: %v", md)
+	}
+	remote := trace.SpanContextFromContext(ExtractMetadata(context.Background(), md))
+	if remote.TraceID() != client.SpanContext().TraceID() || remote.SpanID() != client.SpanContext().SpanID() {
+		t.Fatalf("extract: %v", remote)
+	}
+
+	_, child := StartChild(ctx, "db SELECT", trace.SpanKindClient)
+	child.End()
+	client.End()
+	server.End()
+
+	ended := recorder.Ended()
+	if len(ended) != 3 {
+		t.Fatalf("ended: %d", len(ended))
+	}
+	if ended[0].Parent().SpanID() != client.SpanContext().SpanID() ||
+		ended[2].Parent().SpanID().String() != "00f067aa0ba902b7" {
+		t.Fatal("parent not match")
+	}
+}
+
+func TestFileExporter(t *testing.T) {
+	dir := t.TempDir()
+	c := *configs.Get()
+	defer configs.Set(configs.Set(&c))
+	c.Logger.LogFile = filepath.Join(dir, "app.log")
+
+	//默认在日志文件所在目录
+	path := filepath.Join(dir, common.GetAppName()+".trace")
+	if p := filePath(configs.TraceConfig{}); p != path {
+		t.Fatalf("path: %s", p)
+	}
+
+	defer func() {
+		provider = nil
+		otel.SetTracerProvider(trace.NewNoopTracerProvider())
+		otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator())
+	}()
+	if err := Init(configs.TraceConfig{IsEnable: true, Exporter: "file"}); err != nil {
+		t.Fatal(err)
+	}
+	_, span := Start(context.Background(), "HTTP GET", trace.SpanKindServer)
+	span.End()
+	if err := Shutdown(); err != nil {
+		t.Fatal(err)
+	}
+	if file != nil {
+		t.Fatal("file not closed")
+	}
+	if b, err := os.ReadFile(path); err != nil || len(b) == 0 {
+		t.Fatalf("read: %d, %v", len(b), err)
+	}
+}
@@ -0,0 +1,506 @@
+//Package validator 根据struct的validate标签校验数据
+//如`validate:"required,min=1,max=20"`，多个规则用逗号分隔，参数用=连接
+//内置规则：required、omitempty、min、max、len、oneof、email、url、numeric、alpha、alphanum
+//每个类型的标签只解析一次，标签有错误的时候返回*TagError，可以用Check提前检查
+package validator
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+//TagName 校验规则的标签名
+const TagName = "validate"
+
+//FieldNameTags 错误信息里的字段名，依次从这些标签里取，都没有则用字段名
+var FieldNameTags = []string{"json", "form", "query", "param"}
+
+//Rule 校验规则，v是字段的值(已解引用)，param是=后面的参数，不通过返回错误信息
+type Rule func(v reflect.Value, param string) error
+
+var (
+	rules = map[string]Rule{
+		"min":      ruleMin,
+		"max":      ruleMax,
+		"len":      ruleLen,
+		"oneof":    ruleOneOf,
+		"email":    ruleEmail,
+		"url":      ruleURL,
+		"numeric":  ruleRegexp(regexp.MustCompile(`^[-+]?[0-9]+(\.[0-9]+)?$`), "must be numeric"),
+		"alpha":    ruleRegexp(regexp.MustCompile(`^[a-zA-Z]+$`), "must contain only letters"),
+		"alphanum": ruleRegexp(regexp.MustCompile(`^[a-zA-Z0-9]+$`), "must contain only letters and numbers"),
+	}
+	//解析标签的时候检查参数和字段类型，覆盖内置规则后不再检查
+	ruleChecks = map[string]func(t reflect.Type, param string) error{
+		"min": checkSize,
+		"max": checkSize,
+		"len": checkSize,
+	}
+	mu = new(sync.RWMutex)
+
+	emailRegexp = regexp.MustCompile(`^[a-zA-Z0-9._%+\-]+@[a-zA-Z0-9.\-]+\.[a-zA-Z]{2,}$`)
+	timeType    = reflect.TypeOf(time.Time{})
+)
+
+//RegisterRule 注册自定义规则，同名会覆盖内置规则
+func RegisterRule(name string, rule Rule) {
+	mu.Lock()
+	defer mu.Unlock()
+	rules[name] = rule
+	delete(ruleChecks, name)
+	//已解析的标签可能用到了这个规则
+	structCache.Range(func(key, value interface{}) bool {
+		structCache.Delete(key)
+		return true
+	})
+}
+
+//FieldError 单个字段的错误
+type FieldError struct {
+	//字段名，嵌套的用.连接，如user.name、items[0].id
+	Field string
+	//不通过的规则
+	Rule    string
+	Param   string
+	Message string
+}
+
+func (e *FieldError) Error() string {
+	return fmt.Sprintf("%s %s", e.Field, e.Message)
+}
+
+//Errors 校验不通过的所有字段
+type Errors []*FieldError
+
+func (errs Errors) Error() string {
+	list := make([]string, len(errs))
+	for i, e := range errs {
+		list[i] = e.Error()
+	}
+
+	return strings.Join(list, "; ")
+}
+
+//Map key是字段名，value是错误信息
+func (errs Errors) Map() map[string]string {
+	m := make(map[string]string, len(errs))
+	for _, e := range errs {
+		m[e.Field] = e.Message
+	}
+
+	return m
+}
+
+//TagError 标签写错了，如未定义的规则、错误的参数、不支持的字段类型
+type TagError struct {
+	Type  reflect.Type
+	Field string
+	Tag   string
+	Msg   string
+}
+
+func (e *TagError) Error() string {
+	return fmt.Sprintf("validator: %s.%s `%s`: %s", e.Type, e.Field, e.Tag, e.Msg)
+}
+
+//Check 检查v的类型(包括嵌套的struct)的标签，不校验数据，可以在注册或者启动的时候调用，尽早发现标签的错误
+func Check(v interface{}) error {
+	rt := reflect.TypeOf(v)
+	for rt != nil && rt.Kind() == reflect.Ptr {
+		rt = rt.Elem()
+	}
+	if rt == nil || rt.Kind() != reflect.Struct {
+		return fmt.Errorf("validator: unsupported type %v", rt)
+	}
+
+	_, err := getStructRules(rt)
+
+	return err
+}
+
+//Struct 校验struct，v可以是struct或者struct指针，不通过返回Errors，标签有错误返回*TagError
+func Struct(v interface{}) error {
+	rv := reflect.ValueOf(v)
+	for rv.Kind() == reflect.Ptr {
+		if rv.IsNil() {
+			return errors.New("validator: nil pointer")
+		}
+		rv = rv.Elem()
+	}
+	if rv.Kind() != reflect.Struct {
+		return fmt.Errorf("validator: unsupported type %s", rv.Type())
+	}
+
+	sr, err := getStructRules(rv.Type())
+	if err != nil {
+		return err
+	}
+
+	var errs Errors
+	validateStruct(rv, sr, "", &errs)
+	if len(errs) > 0 {
+		return errs
+	}
+
+	return nil
+}
+
+//parsedRule 解析后的单个规则，required和omitempty的rule是nil
+type parsedRule struct {
+	name  string
+	param string
+	rule  Rule
+}
+
+//fieldRules 需要校验的字段
+type fieldRules struct {
+	index int
+	name  string
+	//嵌入的struct，字段名不加前缀
+	embedded bool
+	rules    []parsedRule
+}
+
+type structRules struct {
+	fields []*fieldRules
+	err    error
+}
+
+//每个类型只解析一次标签，RegisterRule的时候清空
+var structCache sync.Map
+
+func getStructRules(rt reflect.Type) (*structRules, error) {
+	if sr, ok := structCache.Load(rt); ok {
+		return sr.(*structRules), sr.(*structRules).err
+	}
+	sr := parseStruct(rt, make(map[reflect.Type]bool))
+	structCache.Store(rt, sr)
+
+	return sr, sr.err
+}
+
+//parseStruct 解析标签，嵌套的struct也会解析，visiting用于自引用的类型
+func parseStruct(rt reflect.Type, visiting map[reflect.Type]bool) (sr *structRules) {
+	sr = new(structRules)
+	visiting[rt] = true
+	defer delete(visiting, rt)
+
+	for i := 0; i < rt.NumField(); i++ {
+		sf := rt.Field(i)
+		if sf.PkgPath != "" && !sf.Anonymous {
+			continue
+		}
+		tag := sf.Tag.Get(TagName)
+		if tag == "-" {
+			continue
+		}
+		fr := &fieldRules{index: i, name: fieldName(sf), embedded: sf.Anonymous && tag == ""}
+		if !fr.embedded {
+			fr.rules, sr.err = parseTag(rt, sf, tag)
+			if sr.err != nil {
+				return
+			}
+		}
+		if nt := nestedType(sf.Type); nt != nil && !visiting[nt] {
+			if sr.err = parseStruct(nt, visiting).err; sr.err != nil {
+				return
+			}
+		}
+		sr.fields = append(sr.fields, fr)
+	}
+
+	return
+}
+
+func parseTag(rt reflect.Type, sf reflect.StructField, tag string) (list []parsedRule, err error) {
+	ft := sf.Type
+	for ft.Kind() == reflect.Ptr {
+		ft = ft.Elem()
+	}
+
+	mu.RLock()
+	defer mu.RUnlock()
+	for _, item := range strings.Split(tag, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		pr := parsedRule{name: item}
+		if i := strings.Index(item, "="); i >= 0 {
+			pr.name, pr.param = item[:i], item[i+1:]
+		}
+		if pr.name != "required" && pr.name != "omitempty" {
+			var ok bool
+			if pr.rule, ok = rules[pr.name]; !ok {
+				return nil, &TagError{Type: rt, Field: sf.Name, Tag: tag, Msg: "undefined rule " + pr.name}
+			}
+			if check, ok := ruleChecks[pr.name]; ok {
+				if e := check(ft, pr.param); e != nil {
+					return nil, &TagError{Type: rt, Field: sf.Name, Tag: tag, Msg: e.Error()}
+				}
+			}
+		}
+		list = append(list, pr)
+	}
+
+	return
+}
+
+//nestedType 需要校验嵌套的struct类型，包括指针、切片和数组
+func nestedType(t reflect.Type) reflect.Type {
+	for {
+		switch t.Kind() {
+		case reflect.Ptr, reflect.Slice, reflect.Array:
+			t = t.Elem()
+		case reflect.Struct:
+			if t == timeType {
+				return nil
+			}
+			return t
+		default:
+			return nil
+		}
+	}
+}
+
+func validateStruct(rv reflect.Value, sr *structRules, prefix string, errs *Errors) {
+	for _, fr := range sr.fields {
+		fv := rv.Field(fr.index)
+		if fr.embedded {
+			if fv.Kind() == reflect.Ptr {
+				if fv.IsNil() {
+					continue
+				}
+				fv = fv.Elem()
+			}
+			if fv.Kind() == reflect.Struct {
+				validateNested(fv, prefix, errs)
+			}
+			continue
+		}
+
+		name := prefix + fr.name
+		if len(fr.rules) > 0 && !validateField(fv, name, fr.rules, errs) {
+			continue
+		}
+		validateNested(fv, name+".", errs)
+	}
+}
+
+//validateNested 校验嵌套的struct和struct切片，prefix是字段名加上.
+func validateNested(fv reflect.Value, prefix string, errs *Errors) {
+	for fv.Kind() == reflect.Ptr {
+		if fv.IsNil() {
+			return
+		}
+		fv = fv.Elem()
+	}
+	switch fv.Kind() {
+	case reflect.Struct:
+		if fv.Type() == timeType {
+			return
+		}
+		//类型已在parseStruct里检查过
+		if sr, err := getStructRules(fv.Type()); err == nil {
+			validateStruct(fv, sr, prefix, errs)
+		}
+	case reflect.Slice, reflect.Array:
+		name := strings.TrimSuffix(prefix, ".")
+		for i := 0; i < fv.Len(); i++ {
+			validateNested(fv.Index(i), fmt.Sprintf("%s[%d].", name, i), errs)
+		}
+	}
+}
+
+//validateField 返回false表示已有错误或者omitempty跳过，不再校验嵌套
+func validateField(fv reflect.Value, name string, list []parsedRule, errs *Errors) bool {
+	for _, pr := range list {
+		switch pr.name {
+		case "required":
+			if isEmpty(fv) {
+				*errs = append(*errs, &FieldError{Field: name, Rule: pr.name, Message: "is required"})
+				return false
+			}
+			continue
+		case "omitempty":
+			if isEmpty(fv) {
+				return false
+			}
+			continue
+		}
+
+		v := fv
+		for v.Kind() == reflect.Ptr {
+			if v.IsNil() {
+				return false
+			}
+			v = v.Elem()
+		}
+
+		if err := pr.rule(v, pr.param); err != nil {
+			*errs = append(*errs, &FieldError{Field: name, Rule: pr.name, Param: pr.param, Message: err.Error()})
+			return false
+		}
+	}
+
+	return true
+}
+
+func fieldName(sf reflect.StructField) string {
+	for _, tagName := range FieldNameTags {
+		name := strings.Split(sf.Tag.Get(tagName), ",")[0]
+		if name != "" && name != "-" {
+			return name
+		}
+	}
+
+	return sf.Name
+}
+
+func isEmpty(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Slice, reflect.Map, reflect.Array, reflect.String:
+		return v.Len() == 0
+	case reflect.Ptr, reflect.Interface:
+		return v.IsNil()
+	}
+
+	return v.IsZero()
+}
+
+//size 数字取值，字符串、切片、map取长度，ok为false表示不支持的类型
+func size(v reflect.Value) (n float64, isLen, ok bool) {
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(v.Int()), false, true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(v.Uint()), false, true
+	case reflect.Float32, reflect.Float64:
+		return v.Float(), false, true
+	case reflect.String:
+		return float64(utf8.RuneCountInString(v.String())), true, true
+	case reflect.Slice, reflect.Map, reflect.Array:
+		return float64(v.Len()), true, true
+	}
+
+	return
+}
+
+//checkSize min、max、len的参数必须是数字，字段必须是数字、字符串、切片、数组或者map
+func checkSize(t reflect.Type, param string) error {
+	if _, _, ok := size(reflect.Zero(t)); !ok {
+		return fmt.Errorf("unsupported type %s", t)
+	}
+	if _, err := strconv.ParseFloat(param, 64); err != nil {
+		return fmt.Errorf("error param %s", param)
+	}
+
+	return nil
+}
+
+//sizeParam 取值和参数，标签已检查过，这里只是防止自定义的调用
+func sizeParam(v reflect.Value, param string) (n, p float64, isLen bool, err error) {
+	n, isLen, ok := size(v)
+	if !ok {
+		return 0, 0, false, fmt.Errorf("unsupported type %s", v.Type())
+	}
+	p, err = strconv.ParseFloat(param, 64)
+	if err != nil {
+		return 0, 0, false, fmt.Errorf("error param %s", param)
+	}
+
+	return
+}
+
+func ruleMin(v reflect.Value, param string) error {
+	n, p, isLen, err := sizeParam(v, param)
+	if err != nil {
+		return err
+	}
+	if n >= p {
+		return nil
+	}
+	if isLen {
+		return fmt.Errorf("length must be at least %s", param)
+	}
+
+	return fmt.Errorf("must be at least %s", param)
+}
+
+func ruleMax(v reflect.Value, param string) error {
+	n, p, isLen, err := sizeParam(v, param)
+	if err != nil {
+		return err
+	}
+	if n <= p {
+		return nil
+	}
+	if isLen {
+		return fmt.Errorf("length must be at most %s", param)
+	}
+
+	return fmt.Errorf("must be at most %s", param)
+}
+
+func ruleLen(v reflect.Value, param string) error {
+	n, p, isLen, err := sizeParam(v, param)
+	if err != nil {
+		return err
+	}
+	if n == p {
+		return nil
+	}
+	if isLen {
+		return fmt.Errorf("length must be %s", param)
+	}
+
+	return fmt.Errorf("must be %s", param)
+}
+
+//oneof的参数用空格分隔，如oneof=red green
+func ruleOneOf(v reflect.Value, param string) error {
+	s := fmt.Sprintf("%v", v.Interface())
+	for _, p := range strings.Fields(param) {
+		if s == p {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("must be one of [%s]", param)
+}
+
+func ruleEmail(v reflect.Value, param string) error {
+	if v.Kind() == reflect.String && emailRegexp.MatchString(v.String()) {
+		return nil
+	}
+
+	return errors.New("must be a valid email")
+}
+
+func ruleURL(v reflect.Value, param string) error {
+	if v.Kind() == reflect.String {
+		u, err := url.ParseRequestURI(v.String())
+		if err == nil && u.Scheme != "" && u.Host != "" {
+			return nil
+		}
+	}
+
+	return errors.New("must be a valid url")
+}
+
+func ruleRegexp(re *regexp.Regexp, msg string) Rule {
+	return func(v reflect.Value, param string) error {
+		if v.Kind() == reflect.String && re.MatchString(v.String()) {
+			return nil
+		}
+		return errors.New(msg)
+	}
+}
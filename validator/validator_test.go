@@ -0,0 +1,79 @@
+package validator
+
+import (
+	"reflect"
+	"testing"
+)
+
+type address struct {
+	City string `json:"city" validate:"required"`
+}
+
+type user struct {
+	ID      int64     `json:"id" validate:"required,min=1"`
+	Name    string    `form:"name" validate:"min=2,max=4"`
+	Email   string    `json:"email" validate:"omitempty,email"`
+	Color   string    `validate:"oneof=red green"`
+	Tags    []string  `json:"tags" validate:"max=2"`
+	Address *address  `json:"address"`
+	List    []address `json:"list"`
+}
+
+func TestStruct(t *testing.T) {
+	u := user{ID: 1, Name: "中国人", Color: "red", Address: &address{City: "sz"}}
+	if err := Struct(&u); err != nil {
+		t.Fatal(err)
+	}
+
+	u = user{Name: "a", Email: "a@b", Color: "blue", Tags: []string{"a", "b", "c"},
+		Address: &address{}, List: []address{{City: "gz"}, {}}}
+	err := Struct(u)
+	errs, ok := err.(Errors)
+	if !ok {
+		t.Fatalf("expect Errors, got %v", err)
+	}
+	m := errs.Map()
+	for _, field := range []string{"id", "name", "email", "Color", "tags", "address.city", "list[1].city"} {
+		if _, ok := m[field]; !ok {
+			t.Errorf("expect error on %s, got %v", field, m)
+		}
+	}
+	if len(m) != 7 {
+		t.Errorf("expect 7 errors, got %v", m)
+	}
+}
+
+func TestTagError(t *testing.T) {
+	type badRule struct {
+		Name string `validate:"required,notexist"`
+	}
+	type badParam struct {
+		Name string `validate:"min=a"`
+	}
+	type badKind struct {
+		Value interface{} `validate:"max=1"`
+	}
+	type nested struct {
+		List []badParam
+	}
+	for _, v := range []interface{}{badRule{}, &badParam{}, badKind{}, nested{}} {
+		if _, ok := Check(v).(*TagError); !ok {
+			t.Errorf("%T: expect TagError", v)
+		}
+		if _, ok := Struct(v).(*TagError); !ok {
+			t.Errorf("%T: expect TagError", v)
+		}
+	}
+
+	RegisterRule("notexist", func(v reflect.Value, param string) error {
+		return nil
+	})
+	defer func() {
+		mu.Lock()
+		delete(rules, "notexist")
+		mu.Unlock()
+	}()
+	if err := Struct(badRule{Name: "a"}); err != nil {
+		t.Errorf("registered rule: %v", err)
+	}
+}